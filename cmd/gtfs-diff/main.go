@@ -0,0 +1,96 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/danp/catchbus/gtfs"
+)
+
+func main() {
+	var format string
+	fs := flag.NewFlagSet(os.Args[0], flag.ExitOnError)
+	fs.StringVar(&format, "format", "text", "output format, text or json")
+	fs.Parse(os.Args[1:])
+
+	if fs.NArg() != 2 {
+		fmt.Fprintf(os.Stderr, "usage: %s [flags] <old.zip> <new.zip>\n", os.Args[0])
+		os.Exit(2)
+	}
+
+	old, err := gtfs.ReadZipFile(fs.Arg(0))
+	if err != nil {
+		log.Fatal(err)
+	}
+	old.FillMaps()
+
+	cur, err := gtfs.ReadZipFile(fs.Arg(1))
+	if err != nil {
+		log.Fatal(err)
+	}
+	cur.FillMaps()
+
+	d := gtfs.Diff(old, cur)
+
+	switch format {
+	case "json":
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(d); err != nil {
+			log.Fatal(err)
+		}
+	case "text":
+		printText(d)
+	default:
+		log.Fatalf("unknown format %q", format)
+	}
+}
+
+func printText(d *gtfs.FeedDiff) {
+	if d.Empty() {
+		fmt.Println("no changes")
+		return
+	}
+
+	for _, sec := range []struct {
+		name    string
+		changes []gtfs.Change
+	}{
+		{"stops", d.Stops},
+		{"routes", d.Routes},
+		{"trips", d.Trips},
+		{"calendar", d.Calendar},
+		{"calendar_dates", d.CalendarDates},
+	} {
+		if len(sec.changes) == 0 {
+			continue
+		}
+		fmt.Printf("%s:\n", sec.name)
+		for _, c := range sec.changes {
+			fmt.Printf("  %-8s %s", c.Kind, c.ID)
+			if len(c.Fields) > 0 {
+				fmt.Printf(" (%s)", strings.Join(c.Fields, ", "))
+			}
+			fmt.Println()
+		}
+	}
+
+	if len(d.RenamedTrips) > 0 {
+		fmt.Println("renamed trips:")
+		for _, r := range d.RenamedTrips {
+			fmt.Printf("  %s -> %s\n", r.OldID, r.NewID)
+		}
+	}
+
+	if len(d.Timetables) > 0 {
+		fmt.Println("timetables:")
+		for _, t := range d.Timetables {
+			fmt.Printf("  route %s: trips %d -> %d, %d of %d matched trips shifted, mean shift %v, max shift %v\n",
+				t.RouteID, t.OldTrips, t.NewTrips, t.ShiftedTrips, t.MatchedTrips, t.MeanShift, t.MaxShift)
+		}
+	}
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/danp/catchbus/gtfs"
+	"github.com/danp/catchbus/gtfs/geojson"
+)
+
+func main() {
+	fs := flag.NewFlagSet(os.Args[0], flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: %s <gtfs.zip> <stops|shapes|routes>\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	fs.Parse(os.Args[1:])
+
+	if fs.NArg() != 2 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	layers := map[string]func(*gtfs.Static) *geojson.FeatureCollection{
+		"stops":  geojson.Stops,
+		"shapes": geojson.Shapes,
+		"routes": geojson.Routes,
+	}
+	layer, ok := layers[fs.Arg(1)]
+	if !ok {
+		log.Fatalf("unknown layer %q", fs.Arg(1))
+	}
+
+	s, err := gtfs.ReadZipFile(fs.Arg(0))
+	if err != nil {
+		log.Fatal(err)
+	}
+	s.FillMaps()
+
+	if err := layer(s).Write(os.Stdout); err != nil {
+		log.Fatal(err)
+	}
+}
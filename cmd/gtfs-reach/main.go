@@ -0,0 +1,78 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/danp/catchbus/gtfs"
+	"github.com/danp/catchbus/gtfs/router"
+)
+
+func main() {
+	var date, at string
+	var maxDuration time.Duration
+	var format string
+	var opts router.Options
+	fs := flag.NewFlagSet(os.Args[0], flag.ExitOnError)
+	fs.StringVar(&date, "date", "", "service date, as YYYYMMDD (default today)")
+	fs.StringVar(&at, "time", "", "departure time, as HH:MM (default now, required if -date is not today)")
+	fs.DurationVar(&maxDuration, "max", 30*time.Minute, "maximum travel time")
+	fs.StringVar(&format, "format", "text", "output format, text or geojson")
+	fs.IntVar(&opts.MaxTransfers, "max-transfers", router.DefaultMaxTransfers, "maximum transfers between trips")
+	fs.Float64Var(&opts.MaxWalk, "max-walk", router.DefaultMaxWalk, "maximum walk between stops in meters, or -1 for transfers.txt only")
+	fs.DurationVar(&opts.MinTransferTime, "min-transfer", 0, "minimum time to change trips at a stop")
+	fs.Parse(os.Args[1:])
+
+	if fs.NArg() != 2 {
+		fmt.Fprintf(os.Stderr, "usage: %s [flags] <gtfs.zip> <from stop_id>\n", os.Args[0])
+		os.Exit(2)
+	}
+
+	s, err := gtfs.ReadZipFile(fs.Arg(0))
+	if err != nil {
+		log.Fatal(err)
+	}
+	s.FillMaps()
+
+	d, depart, err := s.ParseDeparture(date, at, time.Now())
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	r := router.New(s, opts)
+	reach, err := r.Reachable(fs.Arg(1), d, depart, maxDuration)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	switch format {
+	case "geojson":
+		if err := r.ReachFeatures(reach).Write(os.Stdout); err != nil {
+			log.Fatal(err)
+		}
+	case "text":
+		tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "stop_id\tstop_name\tarrival\tminutes\ttransfers")
+		for _, rc := range reach {
+			var name string
+			if st, ok := s.StopIDsToStops[rc.StopID]; ok {
+				name = st.Name
+			}
+			transfers := ""
+			if rc.Transfers >= 0 {
+				transfers = strconv.Itoa(rc.Transfers)
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%.1f\t%s\n", rc.StopID, name, gtfs.FormatTime(rc.Arrival), rc.Duration.Minutes(), transfers)
+		}
+		if err := tw.Flush(); err != nil {
+			log.Fatal(err)
+		}
+	default:
+		log.Fatalf("unknown format %q", format)
+	}
+}
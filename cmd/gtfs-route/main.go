@@ -0,0 +1,182 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/danp/catchbus/gtfs"
+	"github.com/danp/catchbus/gtfs/gtfsrt"
+	"github.com/danp/catchbus/gtfs/router"
+	"google.golang.org/protobuf/proto"
+)
+
+func main() {
+	var date, at string
+	var format string
+	var tripUpdates string
+	var opts router.Options
+	fs := flag.NewFlagSet(os.Args[0], flag.ExitOnError)
+	fs.StringVar(&date, "date", "", "service date, as YYYYMMDD (default today)")
+	fs.StringVar(&at, "time", "", "departure time, as HH:MM (default now, required if -date is not today)")
+	fs.StringVar(&format, "format", "text", "output format, text or json")
+	fs.StringVar(&tripUpdates, "trip-updates", "", "GTFS-realtime trip updates to apply, as a URL or file")
+	fs.IntVar(&opts.MaxTransfers, "max-transfers", router.DefaultMaxTransfers, "maximum transfers between trips")
+	fs.Float64Var(&opts.MaxWalk, "max-walk", router.DefaultMaxWalk, "maximum walk between stops in meters, or -1 for transfers.txt only")
+	fs.DurationVar(&opts.MinTransferTime, "min-transfer", 0, "minimum time to change trips at a stop")
+	fs.Parse(os.Args[1:])
+
+	if fs.NArg() != 3 {
+		fmt.Fprintf(os.Stderr, "usage: %s [flags] <gtfs.zip> <from stop_id> <to stop_id>\n", os.Args[0])
+		os.Exit(2)
+	}
+
+	s, err := gtfs.ReadZipFile(fs.Arg(0))
+	if err != nil {
+		log.Fatal(err)
+	}
+	s.FillMaps()
+
+	d, depart, err := s.ParseDeparture(date, at, time.Now())
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	r := router.New(s, opts)
+	if tripUpdates != "" {
+		m, err := readFeedMessage(tripUpdates)
+		if err != nil {
+			log.Fatal(err)
+		}
+		r = r.WithTripUpdates(d, m)
+	}
+	js, err := r.Route(fs.Arg(1), fs.Arg(2), d, depart)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	switch format {
+	case "json":
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(jsonJourneys(js)); err != nil {
+			log.Fatal(err)
+		}
+	case "text":
+		printText(s, js)
+	default:
+		log.Fatalf("unknown format %q", format)
+	}
+}
+
+func printText(s *gtfs.Static, js []router.Journey) {
+	if len(js) == 0 {
+		fmt.Println("no journeys found")
+		return
+	}
+
+	stopName := func(id string) string {
+		if st, ok := s.StopIDsToStops[id]; ok && st.Name != "" {
+			return st.Name + " (" + id + ")"
+		}
+		return id
+	}
+
+	for i, j := range js {
+		if i > 0 {
+			fmt.Println()
+		}
+		fmt.Printf("depart %s, arrive %s, %d transfers\n", gtfs.FormatTime(j.Departure()), gtfs.FormatTime(j.Arrival()), j.Transfers())
+		for _, l := range j.Legs {
+			how := "walk"
+			if !l.Walking() {
+				how = "route " + l.RouteID
+				if r, ok := s.RouteIDsToRoutes[l.RouteID]; ok && r.ShortName != "" {
+					how = "route " + r.ShortName
+				}
+				how += ", trip " + l.TripID
+				if l.Realtime {
+					how += " (realtime)"
+				}
+			}
+			fmt.Printf("  %s %s -> %s %s  %s\n",
+				gtfs.FormatTime(l.Departure), stopName(l.FromStopID),
+				gtfs.FormatTime(l.Arrival), stopName(l.ToStopID), how)
+		}
+	}
+}
+
+type jsonJourney struct {
+	Departure string    `json:"departure"`
+	Arrival   string    `json:"arrival"`
+	Transfers int       `json:"transfers"`
+	Legs      []jsonLeg `json:"legs"`
+}
+
+type jsonLeg struct {
+	TripID     string `json:"trip_id,omitempty"`
+	RouteID    string `json:"route_id,omitempty"`
+	FromStopID string `json:"from_stop_id"`
+	ToStopID   string `json:"to_stop_id"`
+	Departure  string `json:"departure"`
+	Arrival    string `json:"arrival"`
+	Realtime   bool   `json:"realtime,omitempty"`
+}
+
+func jsonJourneys(js []router.Journey) []jsonJourney {
+	out := []jsonJourney{}
+	for _, j := range js {
+		jj := jsonJourney{
+			Departure: gtfs.FormatTime(j.Departure()),
+			Arrival:   gtfs.FormatTime(j.Arrival()),
+			Transfers: j.Transfers(),
+		}
+		for _, l := range j.Legs {
+			jj.Legs = append(jj.Legs, jsonLeg{
+				TripID:     l.TripID,
+				RouteID:    l.RouteID,
+				FromStopID: l.FromStopID,
+				ToStopID:   l.ToStopID,
+				Departure:  gtfs.FormatTime(l.Departure),
+				Arrival:    gtfs.FormatTime(l.Arrival),
+				Realtime:   l.Realtime,
+			})
+		}
+		out = append(out, jj)
+	}
+	return out
+}
+
+func readFeedMessage(src string) (*gtfsrt.FeedMessage, error) {
+	var b []byte
+	if strings.HasPrefix(src, "http://") || strings.HasPrefix(src, "https://") {
+		resp, err := http.Get(src)
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("%s: unexpected status %s", src, resp.Status)
+		}
+		if b, err = io.ReadAll(resp.Body); err != nil {
+			return nil, err
+		}
+	} else {
+		var err error
+		if b, err = os.ReadFile(src); err != nil {
+			return nil, err
+		}
+	}
+
+	m := new(gtfsrt.FeedMessage)
+	if err := proto.Unmarshal(b, m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/danp/catchbus/gtfs"
+	"github.com/danp/catchbus/gtfs/gtfsdb"
+	_ "modernc.org/sqlite"
+)
+
+func main() {
+	ctx := context.Background()
+
+	var database string
+	fs := flag.NewFlagSet(os.Args[0], flag.ExitOnError)
+	fs.StringVar(&database, "database", "gtfs.db", "database file")
+	fs.Parse(os.Args[1:])
+
+	if fs.NArg() != 1 {
+		fmt.Fprintf(os.Stderr, "usage: %s [flags] <gtfs.zip>\n", os.Args[0])
+		os.Exit(2)
+	}
+
+	s, err := gtfs.ReadZipFile(fs.Arg(0))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	db, err := sql.Open("sqlite", "file:"+database+"?_pragma=journal_mode(wal)")
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer db.Close()
+
+	if err := gtfsdb.Import(ctx, db, s); err != nil {
+		log.Fatal(err)
+	}
+
+	log.Printf("imported %d trips and %d stop times into %s", len(s.Trips), s.StopTimeTable.Len(), database)
+}
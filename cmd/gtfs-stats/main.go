@@ -0,0 +1,382 @@
+package main
+
+import (
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/danp/catchbus/gtfs"
+)
+
+func main() {
+	var from, to string
+	var peak string
+	var format string
+	var report string
+	fs := flag.NewFlagSet(os.Args[0], flag.ExitOnError)
+	fs.StringVar(&from, "from", "", "first service date, as YYYYMMDD (default today)")
+	fs.StringVar(&to, "to", "", "last service date, as YYYYMMDD (default six days after from)")
+	fs.StringVar(&peak, "peak", "07:00-09:00", "peak period for headways, as HH:MM-HH:MM")
+	fs.StringVar(&format, "format", "table", "output format, table or csv")
+	fs.StringVar(&report, "report", "all", "report to print: counts, routes, days or all (table only)")
+	fs.Parse(os.Args[1:])
+
+	if fs.NArg() != 1 {
+		fmt.Fprintf(os.Stderr, "usage: %s [flags] <gtfs.zip>\n", os.Args[0])
+		os.Exit(2)
+	}
+
+	if format == "csv" && report == "all" {
+		log.Fatal("-format csv requires a single -report")
+	}
+
+	peakFrom, peakTo, err := parsePeriod(peak)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	s, err := gtfs.ReadZipFile(fs.Arg(0))
+	if err != nil {
+		log.Fatal(err)
+	}
+	s.FillMaps()
+
+	start := gtfs.AtNoonMinus12h(time.Now(), s.Location())
+	if from != "" {
+		start, err = s.ParseDate(from)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+	end := gtfs.AtNoonMinus12h(start.Add(12*time.Hour).AddDate(0, 0, 6), s.Location())
+	if to != "" {
+		end, err = s.ParseDate(to)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+	if end.Before(start) {
+		log.Fatal("-to is before -from")
+	}
+
+	st := compute(s, dateRange(s, start, end), peakFrom, peakTo)
+
+	var tables []table
+	if report == "all" || report == "counts" {
+		tables = append(tables, countsTable(s))
+	}
+	if report == "all" || report == "routes" {
+		tables = append(tables, st.routesTable())
+	}
+	if report == "all" || report == "days" {
+		tables = append(tables, st.daysTable())
+	}
+	if len(tables) == 0 {
+		log.Fatalf("unknown report %q", report)
+	}
+
+	for i, t := range tables {
+		if i > 0 {
+			fmt.Println()
+		}
+		switch format {
+		case "table":
+			err = t.writeText(os.Stdout)
+		case "csv":
+			err = t.writeCSV(os.Stdout)
+		default:
+			log.Fatalf("unknown format %q", format)
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+}
+
+type routeStats struct {
+	route *gtfs.Route
+
+	serviceStart, serviceEnd time.Time
+
+	trips       int
+	first, last time.Duration
+	revenue     time.Duration
+	meters      float64
+	peakGaps    []time.Duration
+}
+
+type dayStats struct {
+	date    time.Time
+	trips   int
+	revenue time.Duration
+}
+
+type stats struct {
+	days   []dayStats
+	routes []*routeStats
+}
+
+func compute(s *gtfs.Static, dates []time.Time, peakFrom, peakTo time.Duration) *stats {
+	spans := serviceSpans(s)
+
+	byRoute := make(map[string]*routeStats)
+	for i := range s.Routes {
+		r := &s.Routes[i]
+		rs := &routeStats{route: r}
+		for _, t := range s.Trips {
+			if t.RouteID != r.ID {
+				continue
+			}
+			sp, ok := spans[t.ServiceID]
+			if !ok {
+				continue
+			}
+			if rs.serviceStart.IsZero() || sp[0].Before(rs.serviceStart) {
+				rs.serviceStart = sp[0]
+			}
+			if sp[1].After(rs.serviceEnd) {
+				rs.serviceEnd = sp[1]
+			}
+		}
+		byRoute[r.ID] = rs
+	}
+
+	lengths := make(map[string]float64)
+
+	out := &stats{}
+	for _, d := range dates {
+		ds := dayStats{date: d}
+		active := s.ActiveServicesForDate(d)
+
+		type routeDir struct {
+			routeID string
+			dir     int
+		}
+		starts := make(map[routeDir][]time.Duration)
+
+		for _, t := range s.Trips {
+			if !active[t.ServiceID] {
+				continue
+			}
+			rs, ok := byRoute[t.RouteID]
+			if !ok {
+				continue
+			}
+			sts := s.StopTimesForTrip(t.ID)
+			if len(sts) < 2 {
+				continue
+			}
+
+			first, last := sts[0].DepartureTime, sts[len(sts)-1].ArrivalTime
+			ds.trips++
+			ds.revenue += last - first
+
+			if rs.trips == 0 || first < rs.first {
+				rs.first = first
+			}
+			if last > rs.last {
+				rs.last = last
+			}
+			rs.trips++
+			rs.revenue += last - first
+
+			l, ok := lengths[t.ID]
+			if !ok {
+				l = s.TripLength(t.ID)
+				lengths[t.ID] = l
+			}
+			rs.meters += l
+
+			k := routeDir{t.RouteID, t.DirectionID}
+			starts[k] = append(starts[k], first)
+		}
+
+		for k, deps := range starts {
+			h := gtfs.NewHeadways(deps, peakFrom, peakTo)
+			byRoute[k.routeID].peakGaps = append(byRoute[k.routeID].peakGaps, h.Gaps...)
+		}
+
+		out.days = append(out.days, ds)
+	}
+
+	for _, rs := range byRoute {
+		out.routes = append(out.routes, rs)
+	}
+	sort.Slice(out.routes, func(i, j int) bool { return out.routes[i].route.ID < out.routes[j].route.ID })
+
+	return out
+}
+
+// serviceSpans returns the first and last dates of each service ID
+// from calendar and calendar_dates.
+func serviceSpans(s *gtfs.Static) map[string][2]time.Time {
+	out := make(map[string][2]time.Time)
+	widen := func(id string, start, end time.Time) {
+		sp, ok := out[id]
+		if !ok {
+			out[id] = [2]time.Time{start, end}
+			return
+		}
+		if start.Before(sp[0]) {
+			sp[0] = start
+		}
+		if end.After(sp[1]) {
+			sp[1] = end
+		}
+		out[id] = sp
+	}
+
+	for _, c := range s.Calendar {
+		widen(c.ServiceID, c.StartDate, c.EndDate)
+	}
+	for _, c := range s.CalendarDates {
+		if c.ExceptionType == gtfs.ExceptionTypeAdded {
+			widen(c.ServiceID, c.Date, c.Date)
+		}
+	}
+	return out
+}
+
+func dateRange(s *gtfs.Static, start, end time.Time) []time.Time {
+	var out []time.Time
+	// step from noon to stay on the right date across DST changes
+	for d := start.Add(12 * time.Hour); !d.After(end.Add(12 * time.Hour)); d = d.AddDate(0, 0, 1) {
+		out = append(out, gtfs.AtNoonMinus12h(d, s.Location()))
+	}
+	return out
+}
+
+func parsePeriod(p string) (time.Duration, time.Duration, error) {
+	f, t, ok := strings.Cut(p, "-")
+	if !ok {
+		return 0, 0, fmt.Errorf("period %q not in HH:MM-HH:MM format", p)
+	}
+	from, err := gtfs.ParseClock(f)
+	if err != nil {
+		return 0, 0, err
+	}
+	to, err := gtfs.ParseClock(t)
+	if err != nil {
+		return 0, 0, err
+	}
+	return from, to, nil
+}
+
+type table struct {
+	title  string
+	header []string
+	rows   [][]string
+}
+
+func (t table) writeText(w io.Writer) error {
+	fmt.Fprintf(w, "%s\n\n", t.title)
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, strings.Join(t.header, "\t")+"\t")
+	for _, r := range t.rows {
+		fmt.Fprintln(tw, strings.Join(r, "\t")+"\t")
+	}
+	return tw.Flush()
+}
+
+func (t table) writeCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(t.header); err != nil {
+		return err
+	}
+	if err := cw.WriteAll(t.rows); err != nil {
+		return err
+	}
+	return cw.Error()
+}
+
+func countsTable(s *gtfs.Static) table {
+	t := table{title: "Counts", header: []string{"file", "rows"}}
+	for _, c := range []struct {
+		file string
+		n    int
+	}{
+		{"agency.txt", len(s.Agencies)},
+		{"stops.txt", len(s.Stops)},
+		{"routes.txt", len(s.Routes)},
+		{"trips.txt", len(s.Trips)},
+		{"stop_times.txt", s.StopTimeTable.Len()},
+		{"calendar.txt", len(s.Calendar)},
+		{"calendar_dates.txt", len(s.CalendarDates)},
+		{"shapes.txt", len(s.Shapes)},
+	} {
+		t.rows = append(t.rows, []string{c.file, strconv.Itoa(c.n)})
+	}
+	return t
+}
+
+func (st *stats) routesTable() table {
+	t := table{
+		title: "Routes",
+		header: []string{
+			"route_id", "short_name", "type", "service_start", "service_end",
+			"trips", "trips_per_day", "first_trip", "last_trip",
+			"revenue_hours", "revenue_km", "peak_headway_min",
+		},
+	}
+
+	for _, rs := range st.routes {
+		row := []string{
+			rs.route.ID,
+			rs.route.ShortName,
+			rs.route.Type.String(),
+			formatDate(rs.serviceStart),
+			formatDate(rs.serviceEnd),
+			strconv.Itoa(rs.trips),
+			strconv.FormatFloat(float64(rs.trips)/float64(len(st.days)), 'f', 1, 64),
+		}
+		if rs.trips > 0 {
+			row = append(row, gtfs.FormatTime(rs.first), gtfs.FormatTime(rs.last))
+		} else {
+			row = append(row, "", "")
+		}
+		row = append(row,
+			strconv.FormatFloat(rs.revenue.Hours(), 'f', 1, 64),
+			strconv.FormatFloat(rs.meters/1000, 'f', 1, 64),
+		)
+		if len(rs.peakGaps) > 0 {
+			var sum time.Duration
+			for _, g := range rs.peakGaps {
+				sum += g
+			}
+			avg := sum / time.Duration(len(rs.peakGaps))
+			row = append(row, strconv.FormatFloat(avg.Minutes(), 'f', 1, 64))
+		} else {
+			row = append(row, "")
+		}
+		t.rows = append(t.rows, row)
+	}
+	return t
+}
+
+func (st *stats) daysTable() table {
+	t := table{title: "Days", header: []string{"date", "weekday", "trips", "revenue_hours"}}
+	for _, d := range st.days {
+		t.rows = append(t.rows, []string{
+			formatDate(d.date),
+			d.date.Add(12 * time.Hour).Weekday().String(),
+			strconv.Itoa(d.trips),
+			strconv.FormatFloat(d.revenue.Hours(), 'f', 1, 64),
+		})
+	}
+	return t
+}
+
+func formatDate(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return gtfs.FormatDate(t)
+}
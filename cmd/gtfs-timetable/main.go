@@ -0,0 +1,62 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/danp/catchbus/gtfs"
+	"github.com/danp/catchbus/gtfs/timetable"
+)
+
+func main() {
+	var date, format string
+	var directionID int
+	var opts timetable.Options
+	fs := flag.NewFlagSet(os.Args[0], flag.ExitOnError)
+	fs.StringVar(&date, "date", "", "service date, as YYYYMMDD (default today)")
+	fs.IntVar(&directionID, "direction", 0, "direction_id of trips to include")
+	fs.StringVar(&format, "format", "markdown", "output format, csv, markdown or html")
+	fs.BoolVar(&opts.AllStops, "all-stops", false, "include all stops, not just timepoints")
+	fs.Parse(os.Args[1:])
+
+	if fs.NArg() != 2 {
+		fmt.Fprintf(os.Stderr, "usage: %s [flags] <gtfs.zip> <route_id>\n", os.Args[0])
+		os.Exit(2)
+	}
+
+	s, err := gtfs.ReadZipFile(fs.Arg(0))
+	if err != nil {
+		log.Fatal(err)
+	}
+	s.FillMaps()
+
+	d := gtfs.AtNoonMinus12h(time.Now(), s.Location())
+	if date != "" {
+		d, err = s.ParseDate(date)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	tt, err := timetable.New(s, fs.Arg(1), directionID, d, opts)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	switch format {
+	case "csv":
+		err = tt.WriteCSV(os.Stdout)
+	case "markdown":
+		err = tt.WriteMarkdown(os.Stdout)
+	case "html":
+		err = tt.WriteHTML(os.Stdout)
+	default:
+		log.Fatalf("unknown format %q", format)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
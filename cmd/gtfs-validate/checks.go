@@ -0,0 +1,238 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/danp/catchbus/gtfs"
+)
+
+type severity string
+
+const (
+	severityError   severity = "error"
+	severityWarning severity = "warning"
+)
+
+type problem struct {
+	Severity severity `json:"severity"`
+	File     string   `json:"file"`
+	ID       string   `json:"id,omitempty"`
+	Code     string   `json:"code"`
+	Message  string   `json:"message"`
+}
+
+type validator struct {
+	s        *gtfs.Static
+	date     time.Time
+	maxSpeed float64 // meters per second
+
+	problems []problem
+}
+
+func (v *validator) add(sev severity, file, id, code, format string, args ...interface{}) {
+	v.problems = append(v.problems, problem{
+		Severity: sev,
+		File:     file,
+		ID:       id,
+		Code:     code,
+		Message:  fmt.Sprintf(format, args...),
+	})
+}
+
+func (v *validator) run() []problem {
+	v.checkDuplicates()
+	v.checkStops()
+	v.checkRoutes()
+	v.checkTrips()
+	v.checkStopTimes()
+	v.checkCalendars()
+	return v.problems
+}
+
+func (v *validator) checkDuplicates() {
+	dups := func(file, field string, ids []string) {
+		seen := make(map[string]bool)
+		for _, id := range ids {
+			if seen[id] {
+				v.add(severityError, file, id, "duplicate_id", "duplicate %s %q", field, id)
+			}
+			seen[id] = true
+		}
+	}
+
+	var ids []string
+	if len(v.s.Agencies) > 1 {
+		for _, a := range v.s.Agencies {
+			ids = append(ids, a.ID)
+		}
+		dups("agency.txt", "agency_id", ids)
+	}
+
+	ids = ids[:0]
+	for _, st := range v.s.Stops {
+		ids = append(ids, st.ID)
+	}
+	dups("stops.txt", "stop_id", ids)
+
+	ids = ids[:0]
+	for _, r := range v.s.Routes {
+		ids = append(ids, r.ID)
+	}
+	dups("routes.txt", "route_id", ids)
+
+	ids = ids[:0]
+	for _, t := range v.s.Trips {
+		ids = append(ids, t.ID)
+	}
+	dups("trips.txt", "trip_id", ids)
+
+	ids = ids[:0]
+	for _, c := range v.s.Calendar {
+		ids = append(ids, c.ServiceID)
+	}
+	dups("calendar.txt", "service_id", ids)
+
+	ids = ids[:0]
+	for _, c := range v.s.CalendarDates {
+		ids = append(ids, c.ServiceID+" "+c.Date.Format("20060102"))
+	}
+	dups("calendar_dates.txt", "service_id and date", ids)
+
+	ids = ids[:0]
+	for _, sh := range v.s.Shapes {
+		ids = append(ids, fmt.Sprintf("%s %d", sh.ID, sh.PtSequence))
+	}
+	dups("shapes.txt", "shape_id and shape_pt_sequence", ids)
+}
+
+func (v *validator) checkStops() {
+	for _, st := range v.s.Stops {
+		if st.ParentStation == "" {
+			continue
+		}
+		if _, ok := v.s.StopIDsToStops[st.ParentStation]; !ok {
+			v.add(severityError, "stops.txt", st.ID, "parent_station_not_found", "parent_station %q not found", st.ParentStation)
+			continue
+		}
+
+		seen := map[string]bool{st.ID: true}
+		for p := v.s.StopIDsToStops[st.ParentStation]; p != nil; p = v.s.StopIDsToStops[p.ParentStation] {
+			if seen[p.ID] {
+				v.add(severityError, "stops.txt", st.ID, "parent_station_cycle", "parent_station chain loops back to %q", p.ID)
+				break
+			}
+			seen[p.ID] = true
+		}
+	}
+}
+
+func (v *validator) checkRoutes() {
+	agencies := make(map[string]bool)
+	for _, a := range v.s.Agencies {
+		agencies[a.ID] = true
+	}
+
+	for _, r := range v.s.Routes {
+		if r.AgencyID == "" {
+			if len(v.s.Agencies) > 1 {
+				v.add(severityError, "routes.txt", r.ID, "agency_id_missing", "agency_id required when there are multiple agencies")
+			}
+		} else if !agencies[r.AgencyID] {
+			v.add(severityError, "routes.txt", r.ID, "agency_not_found", "agency_id %q not found", r.AgencyID)
+		}
+
+		if !r.Type.Valid() {
+			v.add(severityWarning, "routes.txt", r.ID, "unknown_route_type", "unknown route_type %d", int(r.Type))
+		}
+	}
+}
+
+func (v *validator) checkTrips() {
+	services := make(map[string]bool)
+	for _, c := range v.s.Calendar {
+		services[c.ServiceID] = true
+	}
+	for _, c := range v.s.CalendarDates {
+		services[c.ServiceID] = true
+	}
+
+	shapes := make(map[string]bool)
+	for _, sh := range v.s.Shapes {
+		shapes[sh.ID] = true
+	}
+
+	for _, t := range v.s.Trips {
+		if _, ok := v.s.RouteIDsToRoutes[t.RouteID]; !ok {
+			v.add(severityError, "trips.txt", t.ID, "route_not_found", "route_id %q not found", t.RouteID)
+		}
+		if !services[t.ServiceID] {
+			v.add(severityError, "trips.txt", t.ID, "service_not_found", "service_id %q not found in calendar or calendar_dates", t.ServiceID)
+		}
+		if t.ShapeID != "" && !shapes[t.ShapeID] {
+			v.add(severityError, "trips.txt", t.ID, "shape_not_found", "shape_id %q not found", t.ShapeID)
+		}
+		if n := len(v.s.StopTimesForTrip(t.ID)); n < 2 {
+			v.add(severityWarning, "trips.txt", t.ID, "too_few_stop_times", "trip has %d stop times", n)
+		}
+	}
+}
+
+func (v *validator) checkStopTimes() {
+	for _, tripID := range v.s.StopTimeTable.TripIDs() {
+		sts := v.s.StopTimesForTrip(tripID)
+		if _, ok := v.s.TripIDsToTrips[tripID]; !ok {
+			v.add(severityError, "stop_times.txt", tripID, "trip_not_found", "trip_id %q not found", tripID)
+		}
+
+		for i, st := range sts {
+			stop, ok := v.s.StopIDsToStops[st.StopID]
+			if !ok {
+				v.add(severityError, "stop_times.txt", tripID, "stop_not_found", "stop_id %q at stop_sequence %d not found", st.StopID, st.StopSequence)
+			}
+
+			if st.DepartureTime < st.ArrivalTime {
+				v.add(severityError, "stop_times.txt", tripID, "departure_before_arrival", "departure_time before arrival_time at stop_sequence %d", st.StopSequence)
+			}
+
+			if i == 0 {
+				continue
+			}
+			prev := sts[i-1]
+
+			if st.StopSequence == prev.StopSequence {
+				v.add(severityError, "stop_times.txt", tripID, "duplicate_stop_sequence", "stop_sequence %d repeated", st.StopSequence)
+			}
+
+			if st.ArrivalTime < prev.DepartureTime {
+				v.add(severityError, "stop_times.txt", tripID, "decreasing_time", "arrival_time at stop_sequence %d (%v) before departure_time at stop_sequence %d (%v)",
+					st.StopSequence, st.ArrivalTime, prev.StopSequence, prev.DepartureTime)
+				continue
+			}
+
+			prevStop, prevOK := v.s.StopIDsToStops[prev.StopID]
+			if !ok || !prevOK || v.maxSpeed <= 0 {
+				continue
+			}
+			dist := prevStop.Point.DistanceTo(stop.Point)
+			secs := (st.ArrivalTime - prev.DepartureTime).Seconds()
+			// a minute of slack covers times rounded to the minute
+			if speed := dist / (secs + 60); speed > v.maxSpeed {
+				v.add(severityWarning, "stop_times.txt", tripID, "unrealistic_speed", "%.0fm in %v between stop_sequence %d and %d",
+					dist, st.ArrivalTime-prev.DepartureTime, prev.StopSequence, st.StopSequence)
+			}
+		}
+	}
+}
+
+func (v *validator) checkCalendars() {
+	for _, c := range v.s.Calendar {
+		if c.EndDate.Before(c.StartDate) {
+			v.add(severityError, "calendar.txt", c.ServiceID, "end_before_start", "end_date %s before start_date %s",
+				c.EndDate.Format("20060102"), c.StartDate.Format("20060102"))
+		}
+		if c.EndDate.Before(v.date) {
+			v.add(severityWarning, "calendar.txt", c.ServiceID, "expired_calendar", "service ended %s", c.EndDate.Format("20060102"))
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/danp/catchbus/gtfs"
+)
+
+func main() {
+	var format string
+	var date string
+	var maxSpeed float64
+	fs := flag.NewFlagSet(os.Args[0], flag.ExitOnError)
+	fs.StringVar(&format, "format", "text", "output format, text or json")
+	fs.StringVar(&date, "date", "", "date to check calendar expiry against, as YYYYMMDD (default today)")
+	fs.Float64Var(&maxSpeed, "max-speed", 150, "speed in km/h between consecutive stops above which to warn, 0 to disable")
+	fs.Parse(os.Args[1:])
+
+	if fs.NArg() != 1 {
+		fmt.Fprintf(os.Stderr, "usage: %s [flags] <gtfs.zip>\n", os.Args[0])
+		os.Exit(2)
+	}
+
+	s, err := gtfs.ReadZipFile(fs.Arg(0))
+	if err != nil {
+		log.Fatal(err)
+	}
+	s.FillMaps()
+
+	tz := time.Local
+	if len(s.Agencies) > 0 {
+		tz = s.Agencies[0].Timezone
+	}
+	d := gtfs.AtNoonMinus12h(time.Now(), tz)
+	if date != "" {
+		pd, err := time.ParseInLocation("20060102", date, tz)
+		if err != nil {
+			log.Fatal(err)
+		}
+		d = gtfs.AtNoonMinus12h(pd, tz)
+	}
+
+	v := &validator{s: s, date: d, maxSpeed: maxSpeed / 3.6}
+	problems := v.run()
+	sort.SliceStable(problems, func(i, j int) bool {
+		if problems[i].File != problems[j].File {
+			return problems[i].File < problems[j].File
+		}
+		return problems[i].ID < problems[j].ID
+	})
+
+	var errs, warns int
+	for _, p := range problems {
+		switch p.Severity {
+		case severityError:
+			errs++
+		case severityWarning:
+			warns++
+		}
+	}
+
+	switch format {
+	case "json":
+		out := struct {
+			Errors   int       `json:"errors"`
+			Warnings int       `json:"warnings"`
+			Problems []problem `json:"problems"`
+		}{errs, warns, problems}
+		if out.Problems == nil {
+			out.Problems = []problem{}
+		}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(out); err != nil {
+			log.Fatal(err)
+		}
+	case "text":
+		for _, p := range problems {
+			fmt.Printf("%s\t%s\t%s\t%s\t%s\n", p.Severity, p.File, p.ID, p.Code, p.Message)
+		}
+		fmt.Printf("%d errors, %d warnings\n", errs, warns)
+	default:
+		log.Fatalf("unknown format %q", format)
+	}
+
+	if errs > 0 {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,152 @@
+package gtfs
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// Block is the sequence of trips operated by one vehicle on a service
+// date, as linked by Trip.BlockID.
+type Block struct {
+	ID string
+
+	// Trips are ordered by start time.
+	Trips []BlockTrip
+}
+
+// BlockTrip is a trip within a Block. Times are durations since noon
+// minus 12h on the service date, as in StopTime.
+type BlockTrip struct {
+	TripID string
+
+	// Start is the departure from the first stop and End the arrival at
+	// the last stop.
+	Start, End time.Duration
+
+	FirstStopID, LastStopID string
+
+	// Layover is the time between the end of the previous trip in the
+	// block and the start of this one. It is zero for the first trip and
+	// negative if the trips overlap.
+	Layover time.Duration
+
+	// Deadhead is true if the previous trip in the block ended at a
+	// different stop than this one starts at.
+	Deadhead bool
+}
+
+// DelayAfterLayover returns the delay expected at the start of the trip
+// given the delay of the previous trip at its end, assuming the vehicle
+// uses as much of the layover as needed to recover.
+func (bt BlockTrip) DelayAfterLayover(delay time.Duration) time.Duration {
+	if d := delay - bt.Layover; d > 0 {
+		return d
+	}
+	return 0
+}
+
+// Check returns an error describing the first pair of trips in b that
+// overlap in time, if any.
+func (b *Block) Check() error {
+	for i := 1; i < len(b.Trips); i++ {
+		if b.Trips[i].Layover < 0 {
+			prev, cur := b.Trips[i-1], b.Trips[i]
+			return fmt.Errorf("block %s: trip %s starts at %s before trip %s ends at %s",
+				b.ID, cur.TripID, FormatTime(cur.Start), prev.TripID, FormatTime(prev.End))
+		}
+	}
+	return nil
+}
+
+// Next returns the trip following the trip with the given ID in b.
+func (b *Block) Next(tripID string) (BlockTrip, bool) {
+	for i, bt := range b.Trips {
+		if bt.TripID == tripID && i+1 < len(b.Trips) {
+			return b.Trips[i+1], true
+		}
+	}
+	return BlockTrip{}, false
+}
+
+// BlocksForDate returns the blocks of trips active on service date d,
+// ordered by block ID. Trips without a block ID are not included.
+// FillMaps must have been called.
+func (s *Static) BlocksForDate(d time.Time) []Block {
+	active := s.ActiveServicesForDate(d)
+	return s.blocks(func(t *Trip) bool { return t.BlockID != "" && active[t.ServiceID] })
+}
+
+// BlockForTrip returns the block containing the trip with the given ID
+// on service date d. FillMaps must have been called.
+func (s *Static) BlockForTrip(tripID string, d time.Time) (Block, bool) {
+	t, ok := s.TripIDsToTrips[tripID]
+	if !ok || t.BlockID == "" {
+		return Block{}, false
+	}
+
+	active := s.ActiveServicesForDate(d)
+	if !active[t.ServiceID] {
+		return Block{}, false
+	}
+
+	bs := s.blocks(func(o *Trip) bool { return o.BlockID == t.BlockID && active[o.ServiceID] })
+	if len(bs) == 0 {
+		return Block{}, false
+	}
+	return bs[0], true
+}
+
+// NextTripInBlock returns the trip the vehicle operating the trip with
+// the given ID on service date d is scheduled to operate next.
+// FillMaps must have been called.
+func (s *Static) NextTripInBlock(tripID string, d time.Time) (BlockTrip, bool) {
+	b, ok := s.BlockForTrip(tripID, d)
+	if !ok {
+		return BlockTrip{}, false
+	}
+	return b.Next(tripID)
+}
+
+func (s *Static) blocks(include func(*Trip) bool) []Block {
+	byID := make(map[string][]BlockTrip)
+	for i := range s.Trips {
+		t := &s.Trips[i]
+		if !include(t) {
+			continue
+		}
+		sts := s.StopTimesForTrip(t.ID)
+		if len(sts) == 0 {
+			continue
+		}
+		first, last := sts[0], sts[len(sts)-1]
+		byID[t.BlockID] = append(byID[t.BlockID], BlockTrip{
+			TripID:      t.ID,
+			Start:       first.DepartureTime,
+			End:         last.ArrivalTime,
+			FirstStopID: first.StopID,
+			LastStopID:  last.StopID,
+		})
+	}
+
+	out := make([]Block, 0, len(byID))
+	for id, bts := range byID {
+		sort.Slice(bts, func(i, j int) bool {
+			if bts[i].Start != bts[j].Start {
+				return bts[i].Start < bts[j].Start
+			}
+			if bts[i].End != bts[j].End {
+				return bts[i].End < bts[j].End
+			}
+			return bts[i].TripID < bts[j].TripID
+		})
+		for i := 1; i < len(bts); i++ {
+			bts[i].Layover = bts[i].Start - bts[i-1].End
+			bts[i].Deadhead = bts[i].FirstStopID != bts[i-1].LastStopID
+		}
+		out = append(out, Block{ID: id, Trips: bts})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].ID < out[j].ID })
+
+	return out
+}
@@ -0,0 +1,322 @@
+package gtfs
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ChangeKind describes how an entity differs between two feeds.
+type ChangeKind int
+
+const (
+	Added ChangeKind = iota
+	Removed
+	Modified
+)
+
+var changeKindNames = []string{"added", "removed", "modified"}
+
+func (k ChangeKind) String() string               { return enumString(changeKindNames, k, "ChangeKind") }
+func (k ChangeKind) MarshalText() ([]byte, error) { return []byte(k.String()), nil }
+
+// Change is a difference in one entity between two feeds.
+type Change struct {
+	Kind ChangeKind
+	ID   string
+
+	// Fields lists the names of the fields that differ when Kind is Modified.
+	Fields []string `json:",omitempty"`
+}
+
+// TripRename is a trip whose ID changed between two feeds but which
+// otherwise appears to be the same trip.
+type TripRename struct {
+	OldID string
+	NewID string
+}
+
+// RouteTimetableChange summarizes how a route's timetable changed.
+type RouteTimetableChange struct {
+	RouteID  string
+	OldTrips int
+	NewTrips int
+
+	// MatchedTrips is the number of trips present in both feeds, by ID
+	// or via a rename, with the same number of stops.
+	MatchedTrips int
+	// ShiftedTrips is the number of matched trips whose first departure moved.
+	ShiftedTrips int
+	// MeanShift and MaxShift are the mean and largest absolute changes
+	// in first departure time across matched trips.
+	MeanShift time.Duration
+	MaxShift  time.Duration
+}
+
+// FeedDiff is the result of Diff.
+type FeedDiff struct {
+	Stops         []Change
+	Routes        []Change
+	Trips         []Change
+	Calendar      []Change
+	CalendarDates []Change
+
+	RenamedTrips []TripRename
+	Timetables   []RouteTimetableChange
+}
+
+// Empty reports whether no differences were found.
+func (d *FeedDiff) Empty() bool {
+	return len(d.Stops) == 0 && len(d.Routes) == 0 && len(d.Trips) == 0 &&
+		len(d.Calendar) == 0 && len(d.CalendarDates) == 0 &&
+		len(d.RenamedTrips) == 0 && len(d.Timetables) == 0
+}
+
+// Diff compares old and cur, keyed by ID.
+//
+// Trips removed from old and added in cur are reported as renames
+// rather than separate removals and additions when they share a route,
+// direction, stop pattern and first departure time.
+//
+// FillMaps must have been called on both old and cur.
+func Diff(old, cur *Static) *FeedDiff {
+	d := &FeedDiff{}
+
+	d.Stops = diffEntities(old.Stops, cur.Stops, func(s Stop) string { return s.ID })
+	d.Routes = diffEntities(old.Routes, cur.Routes, func(r Route) string { return r.ID })
+	d.Calendar = diffEntities(old.Calendar, cur.Calendar, func(c Calendar) string { return c.ServiceID })
+	d.CalendarDates = diffEntities(old.CalendarDates, cur.CalendarDates, func(c CalendarDate) string {
+		return c.ServiceID + " " + FormatDate(c.Date)
+	})
+
+	trips := diffEntities(old.Trips, cur.Trips, func(t Trip) string { return t.ID })
+
+	// trips with identical fields can still have different stop times
+	changed := make(map[string]int)
+	for i, c := range trips {
+		changed[c.ID] = i
+	}
+	for _, t := range cur.Trips {
+		if _, ok := old.TripIDsToTrips[t.ID]; !ok {
+			continue
+		}
+		if stopTimesEqual(old.StopTimesForTrip(t.ID), cur.StopTimesForTrip(t.ID)) {
+			continue
+		}
+		if i, ok := changed[t.ID]; ok {
+			trips[i].Fields = append(trips[i].Fields, "StopTimes")
+			continue
+		}
+		changed[t.ID] = len(trips)
+		trips = append(trips, Change{Kind: Modified, ID: t.ID, Fields: []string{"StopTimes"}})
+	}
+
+	d.Trips, d.RenamedTrips = findTripRenames(old, cur, trips)
+	sortChanges(d.Trips)
+
+	d.Timetables = diffTimetables(old, cur, d.RenamedTrips)
+
+	return d
+}
+
+func diffEntities[T any](old, cur []T, id func(T) string) []Change {
+	oldByID := make(map[string]T, len(old))
+	for _, o := range old {
+		oldByID[id(o)] = o
+	}
+	newByID := make(map[string]T, len(cur))
+	for _, n := range cur {
+		newByID[id(n)] = n
+	}
+
+	var out []Change
+	for k, o := range oldByID {
+		n, ok := newByID[k]
+		if !ok {
+			out = append(out, Change{Kind: Removed, ID: k})
+			continue
+		}
+		if fields := diffFields(o, n); len(fields) > 0 {
+			out = append(out, Change{Kind: Modified, ID: k, Fields: fields})
+		}
+	}
+	for k := range newByID {
+		if _, ok := oldByID[k]; !ok {
+			out = append(out, Change{Kind: Added, ID: k})
+		}
+	}
+
+	sortChanges(out)
+	return out
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// diffFields returns the names of the exported fields that differ
+// between structs a and b.
+func diffFields(a, b interface{}) []string {
+	av, bv := reflect.ValueOf(a), reflect.ValueOf(b)
+
+	var out []string
+	for i := 0; i < av.NumField(); i++ {
+		f := av.Type().Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		af, bf := av.Field(i), bv.Field(i)
+		if f.Type == timeType {
+			if !af.Interface().(time.Time).Equal(bf.Interface().(time.Time)) {
+				out = append(out, f.Name)
+			}
+			continue
+		}
+		if !reflect.DeepEqual(af.Interface(), bf.Interface()) {
+			out = append(out, f.Name)
+		}
+	}
+	return out
+}
+
+func sortChanges(cs []Change) {
+	sort.Slice(cs, func(i, j int) bool {
+		if cs[i].Kind != cs[j].Kind {
+			return cs[i].Kind < cs[j].Kind
+		}
+		return cs[i].ID < cs[j].ID
+	})
+}
+
+func stopTimesEqual(a, b []StopTime) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// tripSignature identifies a trip independent of its trip and service IDs.
+func tripSignature(s *Static, t Trip) string {
+	sts := s.StopTimesForTrip(t.ID)
+	if len(sts) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s|%d|%d", t.RouteID, t.DirectionID, sts[0].DepartureTime)
+	for _, st := range sts {
+		b.WriteByte('|')
+		b.WriteString(st.StopID)
+	}
+	return b.String()
+}
+
+func findTripRenames(old, cur *Static, trips []Change) ([]Change, []TripRename) {
+	removed := make(map[string][]string) // signature -> old trip IDs
+	for _, c := range trips {
+		if c.Kind != Removed {
+			continue
+		}
+		if sig := tripSignature(old, *old.TripIDsToTrips[c.ID]); sig != "" {
+			removed[sig] = append(removed[sig], c.ID)
+		}
+	}
+
+	renamedOld := make(map[string]bool)
+	renamedNew := make(map[string]bool)
+	var renames []TripRename
+	for _, c := range trips {
+		if c.Kind != Added {
+			continue
+		}
+		sig := tripSignature(cur, *cur.TripIDsToTrips[c.ID])
+		ids := removed[sig]
+		if sig == "" || len(ids) == 0 {
+			continue
+		}
+		removed[sig] = ids[1:]
+		renames = append(renames, TripRename{OldID: ids[0], NewID: c.ID})
+		renamedOld[ids[0]] = true
+		renamedNew[c.ID] = true
+	}
+
+	out := trips[:0]
+	for _, c := range trips {
+		if (c.Kind == Removed && renamedOld[c.ID]) || (c.Kind == Added && renamedNew[c.ID]) {
+			continue
+		}
+		out = append(out, c)
+	}
+
+	sort.Slice(renames, func(i, j int) bool { return renames[i].OldID < renames[j].OldID })
+	return out, renames
+}
+
+func diffTimetables(old, cur *Static, renames []TripRename) []RouteTimetableChange {
+	byRoute := make(map[string]*RouteTimetableChange)
+	get := func(routeID string) *RouteTimetableChange {
+		c, ok := byRoute[routeID]
+		if !ok {
+			c = &RouteTimetableChange{RouteID: routeID}
+			byRoute[routeID] = c
+		}
+		return c
+	}
+
+	for _, t := range old.Trips {
+		get(t.RouteID).OldTrips++
+	}
+	for _, t := range cur.Trips {
+		get(t.RouteID).NewTrips++
+	}
+
+	pairs := make(map[string]string) // new trip ID -> old trip ID
+	for _, t := range cur.Trips {
+		if _, ok := old.TripIDsToTrips[t.ID]; ok {
+			pairs[t.ID] = t.ID
+		}
+	}
+	for _, r := range renames {
+		pairs[r.NewID] = r.OldID
+	}
+
+	sums := make(map[string]time.Duration)
+	for newID, oldID := range pairs {
+		ost, nst := old.StopTimesForTrip(oldID), cur.StopTimesForTrip(newID)
+		if len(ost) == 0 || len(ost) != len(nst) {
+			continue
+		}
+		c := get(cur.TripIDsToTrips[newID].RouteID)
+		c.MatchedTrips++
+
+		shift := nst[0].DepartureTime - ost[0].DepartureTime
+		if shift < 0 {
+			shift = -shift
+		}
+		if shift == 0 {
+			continue
+		}
+		c.ShiftedTrips++
+		sums[c.RouteID] += shift
+		if shift > c.MaxShift {
+			c.MaxShift = shift
+		}
+	}
+
+	var out []RouteTimetableChange
+	for id, c := range byRoute {
+		if c.MatchedTrips > 0 {
+			c.MeanShift = sums[id] / time.Duration(c.MatchedTrips)
+		}
+		if c.OldTrips == c.NewTrips && c.ShiftedTrips == 0 {
+			continue
+		}
+		out = append(out, *c)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].RouteID < out[j].RouteID })
+	return out
+}
@@ -0,0 +1,204 @@
+package gtfs
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// PickupDropOffType is a pickup_type or drop_off_type value from stop_times.txt.
+type PickupDropOffType int
+
+const (
+	PickupDropOffRegular              PickupDropOffType = 0
+	PickupDropOffNone                 PickupDropOffType = 1
+	PickupDropOffPhoneAgency          PickupDropOffType = 2
+	PickupDropOffCoordinateWithDriver PickupDropOffType = 3
+)
+
+var pickupDropOffTypeNames = []string{"regular", "none", "phone_agency", "coordinate_with_driver"}
+
+func (t PickupDropOffType) Valid() bool { return enumValid(pickupDropOffTypeNames, t) }
+func (t PickupDropOffType) String() string {
+	return enumString(pickupDropOffTypeNames, t, "PickupDropOffType")
+}
+func (t PickupDropOffType) MarshalText() ([]byte, error) { return []byte(t.String()), nil }
+func (t *PickupDropOffType) UnmarshalText(b []byte) error {
+	return enumUnmarshalText(pickupDropOffTypeNames, t, b, "PickupDropOffType")
+}
+
+// LocationType is a location_type value from stops.txt.
+type LocationType int
+
+const (
+	LocationTypeStop         LocationType = 0
+	LocationTypeStation      LocationType = 1
+	LocationTypeEntranceExit LocationType = 2
+	LocationTypeGenericNode  LocationType = 3
+	LocationTypeBoardingArea LocationType = 4
+)
+
+var locationTypeNames = []string{"stop", "station", "entrance_exit", "generic_node", "boarding_area"}
+
+func (t LocationType) Valid() bool                  { return enumValid(locationTypeNames, t) }
+func (t LocationType) String() string               { return enumString(locationTypeNames, t, "LocationType") }
+func (t LocationType) MarshalText() ([]byte, error) { return []byte(t.String()), nil }
+func (t *LocationType) UnmarshalText(b []byte) error {
+	return enumUnmarshalText(locationTypeNames, t, b, "LocationType")
+}
+
+// WheelchairBoarding is a wheelchair_boarding value from stops.txt.
+type WheelchairBoarding int
+
+const (
+	WheelchairBoardingUnknown     WheelchairBoarding = 0
+	WheelchairBoardingPossible    WheelchairBoarding = 1
+	WheelchairBoardingNotPossible WheelchairBoarding = 2
+)
+
+var wheelchairBoardingNames = []string{"unknown", "possible", "not_possible"}
+
+func (w WheelchairBoarding) Valid() bool { return enumValid(wheelchairBoardingNames, w) }
+func (w WheelchairBoarding) String() string {
+	return enumString(wheelchairBoardingNames, w, "WheelchairBoarding")
+}
+func (w WheelchairBoarding) MarshalText() ([]byte, error) { return []byte(w.String()), nil }
+func (w *WheelchairBoarding) UnmarshalText(b []byte) error {
+	return enumUnmarshalText(wheelchairBoardingNames, w, b, "WheelchairBoarding")
+}
+
+// WheelchairAccessible is a wheelchair_accessible value from trips.txt.
+type WheelchairAccessible int
+
+const (
+	WheelchairAccessibleUnknown WheelchairAccessible = 0
+	WheelchairAccessibleYes     WheelchairAccessible = 1
+	WheelchairAccessibleNo      WheelchairAccessible = 2
+)
+
+var wheelchairAccessibleNames = []string{"unknown", "yes", "no"}
+
+func (w WheelchairAccessible) Valid() bool { return enumValid(wheelchairAccessibleNames, w) }
+func (w WheelchairAccessible) String() string {
+	return enumString(wheelchairAccessibleNames, w, "WheelchairAccessible")
+}
+func (w WheelchairAccessible) MarshalText() ([]byte, error) { return []byte(w.String()), nil }
+func (w *WheelchairAccessible) UnmarshalText(b []byte) error {
+	return enumUnmarshalText(wheelchairAccessibleNames, w, b, "WheelchairAccessible")
+}
+
+// BikesAllowed is a bikes_allowed value from trips.txt.
+type BikesAllowed int
+
+const (
+	BikesAllowedUnknown BikesAllowed = 0
+	BikesAllowedYes     BikesAllowed = 1
+	BikesAllowedNo      BikesAllowed = 2
+)
+
+var bikesAllowedNames = []string{"unknown", "yes", "no"}
+
+func (b BikesAllowed) Valid() bool                  { return enumValid(bikesAllowedNames, b) }
+func (b BikesAllowed) String() string               { return enumString(bikesAllowedNames, b, "BikesAllowed") }
+func (b BikesAllowed) MarshalText() ([]byte, error) { return []byte(b.String()), nil }
+func (b *BikesAllowed) UnmarshalText(t []byte) error {
+	return enumUnmarshalText(bikesAllowedNames, b, t, "BikesAllowed")
+}
+
+// Timepoint is a timepoint value from stop_times.txt.
+type Timepoint int
+
+const (
+	TimepointApproximate Timepoint = 0
+	TimepointExact       Timepoint = 1
+)
+
+var timepointNames = []string{"approximate", "exact"}
+
+func (t Timepoint) Valid() bool                  { return enumValid(timepointNames, t) }
+func (t Timepoint) String() string               { return enumString(timepointNames, t, "Timepoint") }
+func (t Timepoint) MarshalText() ([]byte, error) { return []byte(t.String()), nil }
+func (t *Timepoint) UnmarshalText(b []byte) error {
+	return enumUnmarshalText(timepointNames, t, b, "Timepoint")
+}
+
+// ExceptionType is an exception_type value from calendar_dates.txt.
+type ExceptionType int
+
+const (
+	ExceptionTypeAdded   ExceptionType = 1
+	ExceptionTypeRemoved ExceptionType = 2
+)
+
+var exceptionTypeNames = []string{"", "added", "removed"}
+
+func (e ExceptionType) Valid() bool                  { return enumValid(exceptionTypeNames, e) }
+func (e ExceptionType) String() string               { return enumString(exceptionTypeNames, e, "ExceptionType") }
+func (e ExceptionType) MarshalText() ([]byte, error) { return []byte(e.String()), nil }
+func (e *ExceptionType) UnmarshalText(b []byte) error {
+	return enumUnmarshalText(exceptionTypeNames, e, b, "ExceptionType")
+}
+
+// TransferType is a transfer_type value from transfers.txt.
+type TransferType int
+
+const (
+	TransferRecommended TransferType = 0
+	TransferTimed       TransferType = 1
+	TransferMinTime     TransferType = 2
+	TransferNotPossible TransferType = 3
+	TransferInSeat      TransferType = 4
+	TransferReBoard     TransferType = 5
+)
+
+var transferTypeNames = []string{"recommended", "timed", "min_time", "not_possible", "in_seat", "re_board"}
+
+func (t TransferType) Valid() bool                  { return enumValid(transferTypeNames, t) }
+func (t TransferType) String() string               { return enumString(transferTypeNames, t, "TransferType") }
+func (t TransferType) MarshalText() ([]byte, error) { return []byte(t.String()), nil }
+func (t *TransferType) UnmarshalText(b []byte) error {
+	return enumUnmarshalText(transferTypeNames, t, b, "TransferType")
+}
+
+func enumValid[T ~int](names []string, v T) bool {
+	return v >= 0 && int(v) < len(names) && names[v] != ""
+}
+
+func enumString[T ~int](names []string, v T, typ string) string {
+	if enumValid(names, v) {
+		return names[v]
+	}
+	return typ + "(" + strconv.Itoa(int(v)) + ")"
+}
+
+// enumUnmarshalText accepts either a name or the numeric GTFS value.
+func enumUnmarshalText[T ~int](names []string, v *T, b []byte, typ string) error {
+	s := string(b)
+	for i, n := range names {
+		if n != "" && n == s {
+			*v = T(i)
+			return nil
+		}
+	}
+	i, err := strconv.Atoi(s)
+	if err != nil || !enumValid(names, T(i)) {
+		return fmt.Errorf("invalid %s %q", typ, s)
+	}
+	*v = T(i)
+	return nil
+}
+
+// parseEnum parses the GTFS numeric value s for field, returning def
+// if s is empty.
+func parseEnum[T ~int](names []string, field, s string, def T) (T, error) {
+	if s == "" {
+		return def, nil
+	}
+	i, err := strconv.Atoi(s)
+	if err != nil {
+		return def, fmt.Errorf("%s: %w", field, err)
+	}
+	if !enumValid(names, T(i)) {
+		return def, fmt.Errorf("%s: invalid value %q", field, s)
+	}
+	return T(i), nil
+}
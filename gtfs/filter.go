@@ -0,0 +1,230 @@
+package gtfs
+
+import (
+	"slices"
+	"time"
+)
+
+// BBox is a geographic bounding box.
+type BBox struct {
+	Min Point // south-west corner
+	Max Point // north-east corner
+}
+
+// Contains reports whether p is within b.
+func (b BBox) Contains(p Point) bool {
+	return p.Lat >= b.Min.Lat && p.Lat <= b.Max.Lat &&
+		p.Lon >= b.Min.Lon && p.Lon <= b.Max.Lon
+}
+
+// Filter selects part of a feed with Static.Filter.
+// Zero-valued fields place no restriction.
+type Filter struct {
+	// RouteIDs keeps only trips on these routes.
+	RouteIDs []string
+	// AgencyIDs keeps only trips on routes operated by these agencies.
+	AgencyIDs []string
+	// BBox keeps only trips serving at least one stop inside it.
+	// Such trips are kept whole, including stops outside BBox.
+	BBox *BBox
+	// Start and End keep only service on dates between them, inclusive,
+	// in the form returned by ParseDate. Calendars are clipped to the window,
+	// and dropped if they don't overlap it.
+	Start, End time.Time
+}
+
+// Filter returns a copy of s containing only the parts selected by f.
+//
+// Trips are kept if they satisfy every restriction in f. Stop times,
+// shapes, services, routes, agencies and stops, including parent
+// stations, are then kept only if referenced by a kept trip, so the
+// result is self-consistent.
+//
+// FillMaps must have been called on s. It is not called on the result.
+func (s *Static) Filter(f Filter) *Static {
+	routes := make(map[string]bool)
+	for _, r := range s.Routes {
+		if len(f.RouteIDs) > 0 && !slices.Contains(f.RouteIDs, r.ID) {
+			continue
+		}
+		if len(f.AgencyIDs) > 0 && !slices.Contains(f.AgencyIDs, s.routeAgencyID(r)) {
+			continue
+		}
+		routes[r.ID] = true
+	}
+
+	services := s.servicesInWindow(f.Start, f.End)
+
+	out := &Static{}
+
+	keepStops := make(map[string]bool)
+	keepRoutes := make(map[string]bool)
+	keepServices := make(map[string]bool)
+	keepShapes := make(map[string]bool)
+	for _, t := range s.Trips {
+		if !routes[t.RouteID] {
+			continue
+		}
+		if services != nil && !services[t.ServiceID] {
+			continue
+		}
+		sts := s.StopTimesForTrip(t.ID)
+		if f.BBox != nil && !s.anyStopIn(sts, *f.BBox) {
+			continue
+		}
+
+		out.Trips = append(out.Trips, t)
+		for _, st := range sts {
+			out.StopTimeTable.Append(st)
+			keepStops[st.StopID] = true
+		}
+		keepRoutes[t.RouteID] = true
+		keepServices[t.ServiceID] = true
+		if t.ShapeID != "" {
+			keepShapes[t.ShapeID] = true
+		}
+	}
+
+	// parent stations of kept stops, and their parents
+	for id := range keepStops {
+		seen := make(map[string]bool)
+		for st := s.StopIDsToStops[id]; st != nil && st.ParentStation != "" && !seen[st.ID]; st = s.StopIDsToStops[st.ParentStation] {
+			seen[st.ID] = true
+			keepStops[st.ParentStation] = true
+		}
+	}
+	for _, st := range s.Stops {
+		if keepStops[st.ID] {
+			out.Stops = append(out.Stops, st)
+		}
+	}
+
+	keepAgencies := make(map[string]bool)
+	for _, r := range s.Routes {
+		if keepRoutes[r.ID] {
+			out.Routes = append(out.Routes, r)
+			keepAgencies[s.routeAgencyID(r)] = true
+		}
+	}
+	for _, a := range s.Agencies {
+		if keepAgencies[a.ID] {
+			out.Agencies = append(out.Agencies, a)
+		}
+	}
+	if len(out.Agencies) == 0 && len(s.Agencies) > 0 {
+		// calendar data needs an agency time zone
+		out.Agencies = append(out.Agencies, s.Agencies[0])
+	}
+
+	for _, c := range s.Calendar {
+		if !keepServices[c.ServiceID] {
+			continue
+		}
+		if !f.Start.IsZero() && c.StartDate.Before(f.Start) {
+			c.StartDate = f.Start
+		}
+		if !f.End.IsZero() && c.EndDate.After(f.End) {
+			c.EndDate = f.End
+		}
+		if c.StartDate.After(c.EndDate) {
+			// kept only for calendar_dates additions in the window
+			continue
+		}
+		out.Calendar = append(out.Calendar, c)
+	}
+	for _, c := range s.CalendarDates {
+		if keepServices[c.ServiceID] && inWindow(c.Date, f.Start, f.End) {
+			out.CalendarDates = append(out.CalendarDates, c)
+		}
+	}
+
+	for _, sh := range s.Shapes {
+		if keepShapes[sh.ID] {
+			out.Shapes = append(out.Shapes, sh)
+		}
+	}
+
+	keepTrips := make(map[string]bool)
+	for _, t := range out.Trips {
+		keepTrips[t.ID] = true
+	}
+	for _, t := range s.Transfers {
+		if !keepStops[t.FromStopID] || !keepStops[t.ToStopID] {
+			continue
+		}
+		if (t.FromRouteID != "" && !keepRoutes[t.FromRouteID]) || (t.ToRouteID != "" && !keepRoutes[t.ToRouteID]) {
+			continue
+		}
+		if (t.FromTripID != "" && !keepTrips[t.FromTripID]) || (t.ToTripID != "" && !keepTrips[t.ToTripID]) {
+			continue
+		}
+		out.Transfers = append(out.Transfers, t)
+	}
+
+	return out
+}
+
+// routeAgencyID returns r's agency ID, defaulting to the only agency's.
+func (s *Static) routeAgencyID(r Route) string {
+	if r.AgencyID == "" && len(s.Agencies) == 1 {
+		return s.Agencies[0].ID
+	}
+	return r.AgencyID
+}
+
+func (s *Static) anyStopIn(sts []StopTime, b BBox) bool {
+	for _, st := range sts {
+		if stop, ok := s.StopIDsToStops[st.StopID]; ok && b.Contains(stop.Point) {
+			return true
+		}
+	}
+	return false
+}
+
+// servicesInWindow returns the service IDs active on any date between
+// start and end, or nil if both are zero.
+func (s *Static) servicesInWindow(start, end time.Time) map[string]bool {
+	if start.IsZero() && end.IsZero() {
+		return nil
+	}
+
+	// bound open-ended windows by the calendar data itself
+	if start.IsZero() || end.IsZero() {
+		var first, last time.Time
+		for _, c := range s.Calendar {
+			if first.IsZero() || c.StartDate.Before(first) {
+				first = c.StartDate
+			}
+			if c.EndDate.After(last) {
+				last = c.EndDate
+			}
+		}
+		for _, c := range s.CalendarDates {
+			if first.IsZero() || c.Date.Before(first) {
+				first = c.Date
+			}
+			if c.Date.After(last) {
+				last = c.Date
+			}
+		}
+		if start.IsZero() {
+			start = first
+		}
+		if end.IsZero() {
+			end = last
+		}
+	}
+
+	out := make(map[string]bool)
+	// step from noon to stay on the right date across DST changes
+	for d := start.Add(12 * time.Hour); !d.After(end.Add(12 * time.Hour)); d = d.AddDate(0, 0, 1) {
+		for id := range s.ActiveServicesForDate(AtNoonMinus12h(d, s.Location())) {
+			out[id] = true
+		}
+	}
+	return out
+}
+
+func inWindow(d, start, end time.Time) bool {
+	return (start.IsZero() || !d.Before(start)) && (end.IsZero() || !d.After(end))
+}
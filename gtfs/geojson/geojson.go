@@ -0,0 +1,83 @@
+// Package geojson builds GeoJSON (RFC 7946) documents from GTFS data.
+package geojson
+
+import (
+	"encoding/json"
+	"io"
+
+	"github.com/danp/catchbus/gtfs"
+)
+
+// Geometry is a GeoJSON geometry object.
+type Geometry struct {
+	Type        string      `json:"type"`
+	Coordinates interface{} `json:"coordinates"`
+}
+
+// Point returns a Point geometry for p.
+func Point(p gtfs.Point) *Geometry {
+	return &Geometry{Type: "Point", Coordinates: position(p)}
+}
+
+// LineString returns a LineString geometry through pts.
+func LineString(pts []gtfs.Point) *Geometry {
+	return &Geometry{Type: "LineString", Coordinates: positions(pts)}
+}
+
+// MultiLineString returns a MultiLineString geometry of lines.
+func MultiLineString(lines [][]gtfs.Point) *Geometry {
+	cs := make([][][2]float64, len(lines))
+	for i, l := range lines {
+		cs[i] = positions(l)
+	}
+	return &Geometry{Type: "MultiLineString", Coordinates: cs}
+}
+
+// position returns p in GeoJSON's longitude, latitude order.
+func position(p gtfs.Point) [2]float64 {
+	return [2]float64{p.Lon, p.Lat}
+}
+
+func positions(pts []gtfs.Point) [][2]float64 {
+	out := make([][2]float64, len(pts))
+	for i, p := range pts {
+		out[i] = position(p)
+	}
+	return out
+}
+
+// Feature is a GeoJSON feature.
+type Feature struct {
+	Type       string                 `json:"type"`
+	ID         string                 `json:"id,omitempty"`
+	Geometry   *Geometry              `json:"geometry"`
+	Properties map[string]interface{} `json:"properties"`
+}
+
+// NewFeature returns a feature with the given ID, geometry and
+// properties.
+func NewFeature(id string, g *Geometry, props map[string]interface{}) Feature {
+	if props == nil {
+		props = map[string]interface{}{}
+	}
+	return Feature{Type: "Feature", ID: id, Geometry: g, Properties: props}
+}
+
+// FeatureCollection is a GeoJSON feature collection.
+type FeatureCollection struct {
+	Type     string    `json:"type"`
+	Features []Feature `json:"features"`
+}
+
+// NewFeatureCollection returns a collection of fs.
+func NewFeatureCollection(fs []Feature) *FeatureCollection {
+	if fs == nil {
+		fs = []Feature{}
+	}
+	return &FeatureCollection{Type: "FeatureCollection", Features: fs}
+}
+
+// Write writes fc to w as JSON.
+func (fc *FeatureCollection) Write(w io.Writer) error {
+	return json.NewEncoder(w).Encode(fc)
+}
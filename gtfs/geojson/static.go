@@ -0,0 +1,147 @@
+package geojson
+
+import (
+	"sort"
+
+	"github.com/danp/catchbus/gtfs"
+)
+
+// Stops returns the stops of s with a location as points, with properties
+// for the stop's ID, name, code, location type, parent station and
+// wheelchair boarding.
+func Stops(s *gtfs.Static) *FeatureCollection {
+	var fs []Feature
+	for _, st := range s.Stops {
+		if st.Point == gtfs.NoPoint {
+			continue
+		}
+		fs = append(fs, NewFeature(st.ID, Point(st.Point), map[string]interface{}{
+			"stop_id":             st.ID,
+			"stop_name":           st.Name,
+			"stop_code":           st.Code,
+			"location_type":       st.LocationType.String(),
+			"parent_station":      st.ParentStation,
+			"wheelchair_boarding": st.WheelchairBoarding.String(),
+		}))
+	}
+	return NewFeatureCollection(fs)
+}
+
+// Shapes returns the shapes of s as line strings ordered by shape ID, with
+// properties for the shape's ID and the IDs of the routes using it.
+// FillMaps must have been called.
+func Shapes(s *gtfs.Static) *FeatureCollection {
+	routeIDs := make(map[string]map[string]bool)
+	for _, t := range s.Trips {
+		if t.ShapeID == "" {
+			continue
+		}
+		if routeIDs[t.ShapeID] == nil {
+			routeIDs[t.ShapeID] = make(map[string]bool)
+		}
+		routeIDs[t.ShapeID][t.RouteID] = true
+	}
+
+	ids := make([]string, 0, len(s.ShapeIDsToShapes))
+	for id := range s.ShapeIDsToShapes {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	var fs []Feature
+	for _, id := range ids {
+		pts := shapePoints(s, id)
+		if len(pts) < 2 {
+			continue
+		}
+		fs = append(fs, NewFeature(id, LineString(pts), map[string]interface{}{
+			"shape_id":  id,
+			"route_ids": sortedKeys(routeIDs[id]),
+		}))
+	}
+	return NewFeatureCollection(fs)
+}
+
+// Routes returns one multi line string per route of s, merging the
+// distinct shapes of its trips. Trip patterns without a shape are drawn
+// through their stops instead. Properties hold the route's ID, names and
+// type, and its colors as "#rrggbb" along with a "stroke" property for
+// viewers that follow the simplestyle spec. Routes without any geometry
+// are left out. FillMaps must have been called.
+func Routes(s *gtfs.Static) *FeatureCollection {
+	var fs []Feature
+	for _, r := range s.Routes {
+		var lines [][]gtfs.Point
+		seen := make(map[string]bool)
+		for _, rd := range s.RouteDirections(r.ID) {
+			for _, p := range rd.Patterns {
+				var pts []gtfs.Point
+				if p.ShapeID != "" {
+					if seen[p.ShapeID] {
+						continue
+					}
+					seen[p.ShapeID] = true
+					pts = shapePoints(s, p.ShapeID)
+				}
+				if len(pts) < 2 {
+					pts = stopPoints(s, p.StopIDs)
+				}
+				if len(pts) >= 2 {
+					lines = append(lines, pts)
+				}
+			}
+		}
+		if len(lines) == 0 {
+			continue
+		}
+
+		props := map[string]interface{}{
+			"route_id":         r.ID,
+			"route_short_name": r.ShortName,
+			"route_long_name":  r.LongName,
+			"route_type":       int(r.Type),
+		}
+		if r.Color != "" {
+			props["route_color"] = "#" + r.Color
+			props["stroke"] = "#" + r.Color
+		}
+		if r.TextColor != "" {
+			props["route_text_color"] = "#" + r.TextColor
+		}
+		fs = append(fs, NewFeature(r.ID, MultiLineString(lines), props))
+	}
+	return NewFeatureCollection(fs)
+}
+
+// shapePoints returns the located points of the shape with the given ID
+// in sequence.
+func shapePoints(s *gtfs.Static, shapeID string) []gtfs.Point {
+	var pts []gtfs.Point
+	for _, sh := range s.ShapeIDsToShapes[shapeID] {
+		if sh.Point != gtfs.NoPoint {
+			pts = append(pts, sh.Point)
+		}
+	}
+	return pts
+}
+
+// stopPoints returns the locations of the stops with the given IDs,
+// skipping those without one.
+func stopPoints(s *gtfs.Static, stopIDs []string) []gtfs.Point {
+	var pts []gtfs.Point
+	for _, id := range stopIDs {
+		if st, ok := s.StopIDsToStops[id]; ok && st.Point != gtfs.NoPoint {
+			pts = append(pts, st.Point)
+		}
+	}
+	return pts
+}
+
+func sortedKeys(m map[string]bool) []string {
+	out := make([]string, 0, len(m))
+	for k := range m {
+		out = append(out, k)
+	}
+	sort.Strings(out)
+	return out
+}
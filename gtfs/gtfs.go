@@ -2,6 +2,7 @@ package gtfs
 
 import (
 	"fmt"
+	"math"
 	"sort"
 	"time"
 
@@ -13,15 +14,34 @@ type Static struct {
 	Stops         []Stop
 	Routes        []Route
 	Trips         []Trip
-	StopTimes     []StopTime
 	Calendar      []Calendar
 	CalendarDates []CalendarDate
 	Shapes        []Shape
-
-	RouteIDsToRoutes   map[string]*Route
-	StopIDsToStops     map[string]*Stop
+	Transfers     []Transfer // optional, from transfers.txt
+
+	// StopTimeTable holds the stop times in a compact form and is what
+	// the rest of this package uses.
+	StopTimeTable StopTimes
+
+	// StopTimes holds the same stop times as StopTimeTable, one value per
+	// row. It is only filled when read with ReadOptions.StopTimeRows. If
+	// set when FillMaps is called, StopTimeTable is rebuilt from it.
+	//
+	// Deprecated: Use StopTimeTable, StopTimesForTrip and
+	// StopTimesForStop, which need much less memory.
+	StopTimes []StopTime
+
+	RouteIDsToRoutes map[string]*Route
+	StopIDsToStops   map[string]*Stop
+	TripIDsToTrips   map[string]*Trip
+	ShapeIDsToShapes map[string][]Shape
+
+	// StopIDsToStopTimes and TripIDsToStopTimes index StopTimes. They are
+	// filled by FillMaps only when StopTimes is set.
+	//
+	// Deprecated: Use StopTimesForStop and StopTimesForTrip.
 	StopIDsToStopTimes map[string][]StopTime
-	TripIDsToTrips     map[string]*Trip
+	TripIDsToStopTimes map[string][]StopTime
 }
 
 func (s *Static) FillMaps() {
@@ -46,7 +66,75 @@ func (s *Static) FillMaps() {
 	}
 	s.StopIDsToStops = sidtostp
 
-	s.StopIDsToStopTimes = makeStopIDsToStopTimes(s.StopTimes)
+	s.StopIDsToStopTimes, s.TripIDsToStopTimes = nil, nil
+	if s.StopTimes != nil {
+		s.StopTimeTable = StopTimes{}
+		for _, st := range s.StopTimes {
+			s.StopTimeTable.Append(st)
+		}
+		s.StopIDsToStopTimes = makeStopIDsToStopTimes(s.StopTimes)
+		s.TripIDsToStopTimes = makeTripIDsToStopTimes(s.StopTimes)
+	}
+
+	if !s.StopTimeTable.indexed() {
+		s.StopTimeTable.index()
+	}
+	s.ShapeIDsToShapes = makeShapeIDsToShapes(s.Shapes)
+}
+
+// StopTimesForTrip returns the stop times of the trip with the given ID,
+// ordered by stop sequence.
+func (s *Static) StopTimesForTrip(tripID string) []StopTime {
+	return s.StopTimeTable.forTrip(tripID)
+}
+
+// StopTimesForStop returns the stop times at the stop with the given ID,
+// ordered by departure time.
+func (s *Static) StopTimesForStop(stopID string) []StopTime {
+	return s.StopTimeTable.forStop(stopID)
+}
+
+// Location returns the time zone of the feed's agencies, or UTC if
+// there are none.
+func (s *Static) Location() *time.Location {
+	if len(s.Agencies) == 0 {
+		return time.UTC
+	}
+	return s.Agencies[0].Timezone
+}
+
+// ParseDate parses ds, a date in GTFS YYYYMMDD format, into the form
+// used for service dates, such as Calendar.StartDate and the argument
+// to ActiveServicesForDate.
+func (s *Static) ParseDate(ds string) (time.Time, error) {
+	return parseDateAtNoonInLocation(ds, s.Location())
+}
+
+// ParseDeparture parses a departure given as a date in YYYYMMDD format
+// and a time of day in a form accepted by ParseClock, returning the
+// service date and the time since it. An empty date means today as of
+// now, and an empty time means now, which is only allowed for today.
+func (s *Static) ParseDeparture(date, clock string, now time.Time) (time.Time, time.Duration, error) {
+	today := AtNoonMinus12h(now, s.Location())
+	d := today
+	if date != "" {
+		var err error
+		if d, err = s.ParseDate(date); err != nil {
+			return time.Time{}, 0, err
+		}
+	}
+
+	switch {
+	case clock != "":
+		t, err := ParseClock(clock)
+		if err != nil {
+			return time.Time{}, 0, err
+		}
+		return d, t, nil
+	case d.Equal(today):
+		return d, now.Sub(d), nil
+	}
+	return time.Time{}, 0, errors.New("time required when date is not today")
 }
 
 func (s *Static) ActiveServicesForDate(d time.Time) map[string]bool {
@@ -84,9 +172,9 @@ func (s *Static) ActiveServicesForDate(d time.Time) map[string]bool {
 		}
 
 		switch c.ExceptionType {
-		case "1":
+		case ExceptionTypeAdded:
 			out[c.ServiceID] = true
-		case "2":
+		case ExceptionTypeRemoved:
 			delete(out, c.ServiceID)
 		}
 	}
@@ -114,6 +202,42 @@ func (s *Static) TripIDsForServiceIDs(serviceIDs map[string]bool) map[string]boo
 	return out
 }
 
+// ShapeLength returns the length in meters of the shape with the given ID,
+// measured along its points.
+func (s *Static) ShapeLength(shapeID string) float64 {
+	var length float64
+	pts := s.ShapeIDsToShapes[shapeID]
+	for i := 1; i < len(pts); i++ {
+		if pts[i-1].Point == NoPoint || pts[i].Point == NoPoint {
+			continue
+		}
+		length += pts[i-1].Point.DistanceTo(pts[i].Point)
+	}
+	return length
+}
+
+// TripLength returns the length in meters of the trip with the given ID.
+// The trip's shape is used if it has one, otherwise the straight-line
+// distances between its stops are summed.
+func (s *Static) TripLength(tripID string) float64 {
+	if t, ok := s.TripIDsToTrips[tripID]; ok && t.ShapeID != "" {
+		if l := s.ShapeLength(t.ShapeID); l > 0 {
+			return l
+		}
+	}
+
+	var length float64
+	sts := s.StopTimesForTrip(tripID)
+	for i := 1; i < len(sts); i++ {
+		a, aok := s.StopIDsToStops[sts[i-1].StopID]
+		b, bok := s.StopIDsToStops[sts[i].StopID]
+		if aok && bok {
+			length += a.Point.DistanceTo(b.Point)
+		}
+	}
+	return length
+}
+
 func (s *Static) TripIDsForRouteID(routeID string) map[string]bool {
 	out := make(map[string]bool)
 	for _, t := range s.Trips {
@@ -135,6 +259,19 @@ func (p Point) String() string {
 
 var NoPoint = Point{-4242, -4242}
 
+const earthRadius = 6371008.8 // meters
+
+// DistanceTo returns the great-circle distance between p and q in meters.
+func (p Point) DistanceTo(q Point) float64 {
+	lat1, lat2 := p.Lat*math.Pi/180, q.Lat*math.Pi/180
+	dlat := lat2 - lat1
+	dlon := (q.Lon - p.Lon) * math.Pi / 180
+
+	a := math.Sin(dlat/2)*math.Sin(dlat/2) +
+		math.Cos(lat1)*math.Cos(lat2)*math.Sin(dlon/2)*math.Sin(dlon/2)
+	return 2 * earthRadius * math.Asin(math.Sqrt(a))
+}
+
 type Agency struct {
 	ID       string
 	Name     string
@@ -154,10 +291,10 @@ type Stop struct {
 	Point              Point
 	ZoneID             string
 	URL                string
-	LocationType       int
+	LocationType       LocationType
 	ParentStation      string
 	Timezone           string
-	WheelchairBoarding int
+	WheelchairBoarding WheelchairBoarding
 }
 
 type Route struct {
@@ -166,7 +303,7 @@ type Route struct {
 	ShortName string
 	LongName  string
 	Desc      string
-	Type      int
+	Type      RouteType
 	URL       string
 	Color     string
 	TextColor string
@@ -181,8 +318,8 @@ type Trip struct {
 	DirectionID          int
 	BlockID              string
 	ShapeID              string
-	WheelchairAccessible int
-	BikesAllowed         int
+	WheelchairAccessible WheelchairAccessible
+	BikesAllowed         BikesAllowed
 }
 
 const NoShapeDistTraveled = float64(-42.42)
@@ -194,10 +331,10 @@ type StopTime struct {
 	StopID            string
 	StopSequence      int
 	StopHeadsign      string
-	PickupType        int
-	DropOffType       int
+	PickupType        PickupDropOffType
+	DropOffType       PickupDropOffType
 	ShapeDistTraveled float64
-	Timepoint         int
+	Timepoint         Timepoint
 }
 
 type Calendar struct {
@@ -216,7 +353,7 @@ type Calendar struct {
 type CalendarDate struct {
 	ServiceID     string
 	Date          time.Time
-	ExceptionType string
+	ExceptionType ExceptionType
 }
 
 type Shape struct {
@@ -226,33 +363,116 @@ type Shape struct {
 	DistTraveled float64
 }
 
+type Transfer struct {
+	FromStopID  string
+	ToStopID    string
+	FromRouteID string
+	ToRouteID   string
+	FromTripID  string
+	ToTripID    string
+	Type        TransferType
+
+	// MinTransferTime is only meaningful for TransferMinTime.
+	MinTransferTime time.Duration
+}
+
+// FormatTime formats d, a time since noon minus 12h as in StopTime,
+// in GTFS H:MM:SS format. Hours may exceed 23.
+func FormatTime(d time.Duration) string {
+	sign := ""
+	if d < 0 {
+		sign = "-"
+		d = -d
+	}
+	d = d.Round(time.Second)
+	h := d / time.Hour
+	m := (d % time.Hour) / time.Minute
+	sec := (d % time.Minute) / time.Second
+	return fmt.Sprintf("%s%02d:%02d:%02d", sign, h, m, sec)
+}
+
+// FormatDate formats t, a service date as returned by ParseDate, in
+// GTFS YYYYMMDD format.
+func FormatDate(t time.Time) string {
+	return t.Add(12 * time.Hour).Format("20060102")
+}
+
 func AtNoonMinus12h(t time.Time, loc *time.Location) time.Time {
 	y, m, d := t.Date()
 	return time.Date(y, m, d, 12, 0, 0, 0, loc).Add(-(12 * time.Hour))
 }
 
+// makeStopIDsToStopTimes indexes a copy of sts by stop ID, with each
+// stop's stop times ordered by departure time.
 func makeStopIDsToStopTimes(sts []StopTime) map[string][]StopTime {
-	sort.Slice(sts, func(i, j int) bool { return sts[i].StopID < sts[j].StopID })
+	sorted := make([]StopTime, len(sts))
+	copy(sorted, sts)
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].StopID != sorted[j].StopID {
+			return sorted[i].StopID < sorted[j].StopID
+		}
+		if sorted[i].DepartureTime != sorted[j].DepartureTime {
+			return sorted[i].DepartureTime < sorted[j].DepartureTime
+		}
+		return sorted[i].TripID < sorted[j].TripID
+	})
 
-	// index them by stop ID
 	out := make(map[string][]StopTime)
+	for i := 0; i < len(sorted); {
+		j := i + 1
+		for j < len(sorted) && sorted[j].StopID == sorted[i].StopID {
+			j++
+		}
+		out[sorted[i].StopID] = sorted[i:j:j]
+		i = j
+	}
+	return out
+}
 
-	var (
-		stopStart  int
-		lastStopID string
-	)
+// makeTripIDsToStopTimes indexes a copy of sts by trip ID, with each
+// trip's stop times ordered by stop sequence.
+func makeTripIDsToStopTimes(sts []StopTime) map[string][]StopTime {
+	sorted := make([]StopTime, len(sts))
+	copy(sorted, sts)
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].TripID != sorted[j].TripID {
+			return sorted[i].TripID < sorted[j].TripID
+		}
+		return sorted[i].StopSequence < sorted[j].StopSequence
+	})
 
-	if len(sts) > 0 {
-		lastStopID = sts[0].StopID
+	out := make(map[string][]StopTime)
+	for i := 0; i < len(sorted); {
+		j := i + 1
+		for j < len(sorted) && sorted[j].TripID == sorted[i].TripID {
+			j++
+		}
+		out[sorted[i].TripID] = sorted[i:j:j]
+		i = j
 	}
+	return out
+}
 
-	for i, st := range sts {
-		if st.StopID != lastStopID || i == len(sts)-1 {
-			out[lastStopID] = sts[stopStart:i]
-			stopStart = i
+// makeShapeIDsToShapes indexes a copy of shs by shape ID, with each
+// shape's points ordered by sequence.
+func makeShapeIDsToShapes(shs []Shape) map[string][]Shape {
+	sorted := make([]Shape, len(shs))
+	copy(sorted, shs)
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].ID != sorted[j].ID {
+			return sorted[i].ID < sorted[j].ID
+		}
+		return sorted[i].PtSequence < sorted[j].PtSequence
+	})
+
+	out := make(map[string][]Shape)
+	for i := 0; i < len(sorted); {
+		j := i + 1
+		for j < len(sorted) && sorted[j].ID == sorted[i].ID {
+			j++
 		}
-		lastStopID = st.StopID
+		out[sorted[i].ID] = sorted[i:j:j]
+		i = j
 	}
-
 	return out
 }
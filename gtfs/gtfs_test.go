@@ -0,0 +1,80 @@
+package gtfs
+
+import (
+	"reflect"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestFillMapsStopTimes(t *testing.T) {
+	sts := []StopTime{
+		{TripID: "t2", StopID: "B", StopSequence: 1, DepartureTime: 9 * time.Hour},
+		{TripID: "t1", StopID: "A", StopSequence: 1, DepartureTime: 8 * time.Hour},
+		{TripID: "t1", StopID: "B", StopSequence: 2, DepartureTime: 8*time.Hour + 5*time.Minute},
+		{TripID: "t2", StopID: "C", StopSequence: 2, DepartureTime: 9*time.Hour + 5*time.Minute},
+		// Z sorts last and has a single row
+		{TripID: "t2", StopID: "Z", StopSequence: 3, DepartureTime: 9*time.Hour + 10*time.Minute},
+	}
+	s := &Static{StopTimes: slices.Clone(sts)}
+	s.FillMaps()
+
+	if !reflect.DeepEqual(s.StopTimes, sts) {
+		t.Errorf("FillMaps reordered StopTimes: got %+v", s.StopTimes)
+	}
+
+	for _, st := range sts {
+		if !slices.Contains(s.StopIDsToStopTimes[st.StopID], st) {
+			t.Errorf("StopIDsToStopTimes[%q] missing %+v", st.StopID, st)
+		}
+		if !slices.Contains(s.TripIDsToStopTimes[st.TripID], st) {
+			t.Errorf("TripIDsToStopTimes[%q] missing %+v", st.TripID, st)
+		}
+	}
+	var n int
+	for _, v := range s.StopIDsToStopTimes {
+		n += len(v)
+	}
+	if n != len(sts) {
+		t.Errorf("StopIDsToStopTimes has %d stop times, want %d", n, len(sts))
+	}
+
+	if got := s.StopIDsToStopTimes["B"]; len(got) != 2 || got[0].TripID != "t1" || got[1].TripID != "t2" {
+		t.Errorf("StopIDsToStopTimes[B] not ordered by departure: %+v", got)
+	}
+}
+
+func TestParseDeparture(t *testing.T) {
+	loc, err := time.LoadLocation("America/Halifax")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &Static{Agencies: []Agency{{ID: "a", Timezone: loc}}}
+	now := time.Date(2026, 3, 2, 7, 30, 0, 0, loc)
+	today := AtNoonMinus12h(now, loc)
+	tomorrow := AtNoonMinus12h(now.AddDate(0, 0, 1), loc)
+
+	for _, tc := range []struct {
+		date, clock string
+		wantDate    time.Time
+		wantDepart  time.Duration
+		wantErr     bool
+	}{
+		{"", "", today, 7*time.Hour + 30*time.Minute, false},
+		{"20260302", "", today, 7*time.Hour + 30*time.Minute, false},
+		{"", "25:10", today, 25*time.Hour + 10*time.Minute, false},
+		{"20260303", "8:00:30", tomorrow, 8*time.Hour + 30*time.Second, false},
+		{"20260303", "", time.Time{}, 0, true},
+		{"2026-03-03", "8:00", time.Time{}, 0, true},
+		{"", "8h", time.Time{}, 0, true},
+	} {
+		d, depart, err := s.ParseDeparture(tc.date, tc.clock, now)
+		if (err != nil) != tc.wantErr {
+			t.Errorf("ParseDeparture(%q, %q): got error %v, want error %v", tc.date, tc.clock, err, tc.wantErr)
+			continue
+		}
+		if !d.Equal(tc.wantDate) || depart != tc.wantDepart {
+			t.Errorf("ParseDeparture(%q, %q) = %s, %s, want %s, %s", tc.date, tc.clock, d, depart, tc.wantDate, tc.wantDepart)
+		}
+	}
+}
@@ -0,0 +1,272 @@
+// Package gtfsdb loads GTFS static data into a SQL database.
+//
+// Tables and columns follow the names used in the GTFS files. Times are
+// stored both as GTFS H:MM:SS text and as seconds after noon minus 12h
+// in *_secs columns, and dates as YYYYMMDD text.
+package gtfsdb
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+
+	"github.com/danp/catchbus/gtfs"
+	"github.com/graxinc/errutil"
+)
+
+var schema = []string{
+	`CREATE TABLE IF NOT EXISTS agency (
+		agency_id TEXT PRIMARY KEY,
+		agency_name TEXT,
+		agency_url TEXT,
+		agency_timezone TEXT,
+		agency_lang TEXT,
+		agency_phone TEXT,
+		agency_fare_url TEXT,
+		agency_email TEXT
+	)`,
+	`CREATE TABLE IF NOT EXISTS stops (
+		stop_id TEXT PRIMARY KEY,
+		stop_code TEXT,
+		stop_name TEXT,
+		stop_desc TEXT,
+		stop_lat REAL,
+		stop_lon REAL,
+		zone_id TEXT,
+		stop_url TEXT,
+		location_type INTEGER,
+		parent_station TEXT,
+		stop_timezone TEXT,
+		wheelchair_boarding INTEGER
+	)`,
+	`CREATE TABLE IF NOT EXISTS routes (
+		route_id TEXT PRIMARY KEY,
+		agency_id TEXT,
+		route_short_name TEXT,
+		route_long_name TEXT,
+		route_desc TEXT,
+		route_type INTEGER,
+		route_url TEXT,
+		route_color TEXT,
+		route_text_color TEXT
+	)`,
+	`CREATE TABLE IF NOT EXISTS trips (
+		route_id TEXT,
+		service_id TEXT,
+		trip_id TEXT PRIMARY KEY,
+		trip_headsign TEXT,
+		trip_short_name TEXT,
+		direction_id INTEGER,
+		block_id TEXT,
+		shape_id TEXT,
+		wheelchair_accessible INTEGER,
+		bikes_allowed INTEGER
+	)`,
+	`CREATE INDEX IF NOT EXISTS trips_route_id ON trips (route_id)`,
+	`CREATE INDEX IF NOT EXISTS trips_service_id ON trips (service_id)`,
+	`CREATE TABLE IF NOT EXISTS stop_times (
+		trip_id TEXT,
+		arrival_time TEXT,
+		arrival_time_secs INTEGER,
+		departure_time TEXT,
+		departure_time_secs INTEGER,
+		stop_id TEXT,
+		stop_sequence INTEGER,
+		stop_headsign TEXT,
+		pickup_type INTEGER,
+		drop_off_type INTEGER,
+		shape_dist_traveled REAL,
+		timepoint INTEGER,
+		PRIMARY KEY (trip_id, stop_sequence)
+	) WITHOUT ROWID`,
+	`CREATE INDEX IF NOT EXISTS stop_times_stop_id ON stop_times (stop_id, departure_time_secs)`,
+	`CREATE TABLE IF NOT EXISTS calendar (
+		service_id TEXT PRIMARY KEY,
+		monday INTEGER,
+		tuesday INTEGER,
+		wednesday INTEGER,
+		thursday INTEGER,
+		friday INTEGER,
+		saturday INTEGER,
+		sunday INTEGER,
+		start_date TEXT,
+		end_date TEXT
+	)`,
+	`CREATE TABLE IF NOT EXISTS calendar_dates (
+		service_id TEXT,
+		date TEXT,
+		exception_type INTEGER,
+		PRIMARY KEY (service_id, date)
+	) WITHOUT ROWID`,
+	`CREATE INDEX IF NOT EXISTS calendar_dates_date ON calendar_dates (date)`,
+	`CREATE TABLE IF NOT EXISTS shapes (
+		shape_id TEXT,
+		shape_pt_lat REAL,
+		shape_pt_lon REAL,
+		shape_pt_sequence INTEGER,
+		shape_dist_traveled REAL,
+		PRIMARY KEY (shape_id, shape_pt_sequence)
+	) WITHOUT ROWID`,
+	`CREATE TABLE IF NOT EXISTS transfers (
+		from_stop_id TEXT,
+		to_stop_id TEXT,
+		from_route_id TEXT,
+		to_route_id TEXT,
+		from_trip_id TEXT,
+		to_trip_id TEXT,
+		transfer_type INTEGER,
+		min_transfer_time INTEGER
+	)`,
+	`CREATE INDEX IF NOT EXISTS transfers_from_stop_id ON transfers (from_stop_id)`,
+}
+
+var tables = []string{"agency", "stops", "routes", "trips", "stop_times", "calendar", "calendar_dates", "shapes", "transfers"}
+
+// Import creates the GTFS tables in db if needed and replaces their
+// contents with s, in a single transaction.
+func Import(ctx context.Context, db *sql.DB, s *gtfs.Static) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return errutil.With(err)
+	}
+	defer tx.Rollback()
+
+	for _, q := range schema {
+		if _, err := tx.ExecContext(ctx, q); err != nil {
+			return errutil.With(err)
+		}
+	}
+	for _, t := range tables {
+		if _, err := tx.ExecContext(ctx, `DELETE FROM `+t); err != nil {
+			return errutil.With(err)
+		}
+	}
+
+	ins := func(table string, columns []string, n int, row func(i int) []interface{}) error {
+		q := `INSERT INTO ` + table + ` (` + strings.Join(columns, ", ") + `) VALUES (?` + strings.Repeat(", ?", len(columns)-1) + `)`
+		stmt, err := tx.PrepareContext(ctx, q)
+		if err != nil {
+			return errutil.With(err)
+		}
+		defer stmt.Close()
+
+		for i := 0; i < n; i++ {
+			if _, err := stmt.ExecContext(ctx, row(i)...); err != nil {
+				return errutil.With(err)
+			}
+		}
+		return nil
+	}
+
+	err = ins("agency", []string{"agency_id", "agency_name", "agency_url", "agency_timezone", "agency_lang", "agency_phone", "agency_fare_url", "agency_email"},
+		len(s.Agencies), func(i int) []interface{} {
+			a := s.Agencies[i]
+			return []interface{}{a.ID, a.Name, a.URL, a.Timezone.String(), a.Lang, a.Phone, a.FareURL, a.Email}
+		})
+	if err != nil {
+		return err
+	}
+
+	err = ins("stops", []string{"stop_id", "stop_code", "stop_name", "stop_desc", "stop_lat", "stop_lon", "zone_id", "stop_url", "location_type", "parent_station", "stop_timezone", "wheelchair_boarding"},
+		len(s.Stops), func(i int) []interface{} {
+			st := s.Stops[i]
+			lat, lon := point(st.Point)
+			return []interface{}{st.ID, st.Code, st.Name, st.Desc, lat, lon, st.ZoneID, st.URL, int(st.LocationType), st.ParentStation, st.Timezone, int(st.WheelchairBoarding)}
+		})
+	if err != nil {
+		return err
+	}
+
+	err = ins("routes", []string{"route_id", "agency_id", "route_short_name", "route_long_name", "route_desc", "route_type", "route_url", "route_color", "route_text_color"},
+		len(s.Routes), func(i int) []interface{} {
+			r := s.Routes[i]
+			return []interface{}{r.ID, r.AgencyID, r.ShortName, r.LongName, r.Desc, int(r.Type), r.URL, r.Color, r.TextColor}
+		})
+	if err != nil {
+		return err
+	}
+
+	err = ins("trips", []string{"route_id", "service_id", "trip_id", "trip_headsign", "trip_short_name", "direction_id", "block_id", "shape_id", "wheelchair_accessible", "bikes_allowed"},
+		len(s.Trips), func(i int) []interface{} {
+			t := s.Trips[i]
+			return []interface{}{t.RouteID, t.ServiceID, t.ID, t.Headsign, t.ShortName, t.DirectionID, t.BlockID, t.ShapeID, int(t.WheelchairAccessible), int(t.BikesAllowed)}
+		})
+	if err != nil {
+		return err
+	}
+
+	err = ins("stop_times", []string{"trip_id", "arrival_time", "arrival_time_secs", "departure_time", "departure_time_secs", "stop_id", "stop_sequence", "stop_headsign", "pickup_type", "drop_off_type", "shape_dist_traveled", "timepoint"},
+		s.StopTimeTable.Len(), func(i int) []interface{} {
+			st := s.StopTimeTable.At(i)
+			return []interface{}{
+				st.TripID,
+				gtfs.FormatTime(st.ArrivalTime), int64(st.ArrivalTime.Seconds()),
+				gtfs.FormatTime(st.DepartureTime), int64(st.DepartureTime.Seconds()),
+				st.StopID, st.StopSequence, st.StopHeadsign, int(st.PickupType), int(st.DropOffType),
+				dist(st.ShapeDistTraveled), int(st.Timepoint),
+			}
+		})
+	if err != nil {
+		return err
+	}
+
+	err = ins("calendar", []string{"service_id", "monday", "tuesday", "wednesday", "thursday", "friday", "saturday", "sunday", "start_date", "end_date"},
+		len(s.Calendar), func(i int) []interface{} {
+			c := s.Calendar[i]
+			return []interface{}{c.ServiceID, c.Monday, c.Tuesday, c.Wednesday, c.Thursday, c.Friday, c.Saturday, c.Sunday, gtfs.FormatDate(c.StartDate), gtfs.FormatDate(c.EndDate)}
+		})
+	if err != nil {
+		return err
+	}
+
+	err = ins("calendar_dates", []string{"service_id", "date", "exception_type"},
+		len(s.CalendarDates), func(i int) []interface{} {
+			c := s.CalendarDates[i]
+			return []interface{}{c.ServiceID, gtfs.FormatDate(c.Date), int(c.ExceptionType)}
+		})
+	if err != nil {
+		return err
+	}
+
+	err = ins("shapes", []string{"shape_id", "shape_pt_lat", "shape_pt_lon", "shape_pt_sequence", "shape_dist_traveled"},
+		len(s.Shapes), func(i int) []interface{} {
+			sh := s.Shapes[i]
+			lat, lon := point(sh.Point)
+			return []interface{}{sh.ID, lat, lon, sh.PtSequence, dist(sh.DistTraveled)}
+		})
+	if err != nil {
+		return err
+	}
+
+	err = ins("transfers", []string{"from_stop_id", "to_stop_id", "from_route_id", "to_route_id", "from_trip_id", "to_trip_id", "transfer_type", "min_transfer_time"},
+		len(s.Transfers), func(i int) []interface{} {
+			t := s.Transfers[i]
+			var mt interface{}
+			if t.Type == gtfs.TransferMinTime || t.MinTransferTime > 0 {
+				mt = int64(t.MinTransferTime.Seconds())
+			}
+			return []interface{}{t.FromStopID, t.ToStopID, t.FromRouteID, t.ToRouteID, t.FromTripID, t.ToTripID, int(t.Type), mt}
+		})
+	if err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return errutil.With(err)
+	}
+	return nil
+}
+
+func point(p gtfs.Point) (interface{}, interface{}) {
+	if p == gtfs.NoPoint {
+		return nil, nil
+	}
+	return p.Lat, p.Lon
+}
+
+func dist(d float64) interface{} {
+	if d == gtfs.NoShapeDistTraveled {
+		return nil
+	}
+	return d
+}
@@ -1,10 +1,15 @@
 package feed
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"io"
 	"log"
+	"math/rand"
 	"net"
 	"net/http"
+	"sync"
 	"sync/atomic"
 	"time"
 
@@ -16,6 +21,14 @@ import (
 // It is used when Feed.Interval is zero.
 const DefaultInterval = 10 * time.Second
 
+// DefaultMaxBackoff is the default limit on the time between retries of
+// a failing feed. It is used when Feed.MaxBackoff is zero.
+const DefaultMaxBackoff = 5 * time.Minute
+
+// ErrRunning is returned by Run, and Start panics with it, if the feed
+// is already running.
+var ErrRunning = errors.New("feed already running")
+
 type Feed struct {
 	TripUpdatesURL      string
 	VehiclePositionsURL string
@@ -25,41 +38,322 @@ type Feed struct {
 	// An Interval of zero means the DefaultInterval will be used.
 	Interval time.Duration
 
-	tripUpdates      atomic.Value
-	vehiclePositions atomic.Value
-	alerts           atomic.Value
+	// MaxBackoff limits how long to wait before retrying a feed after
+	// failed fetches. Each consecutive failure doubles the wait from
+	// Interval, and up to half again is added as jitter. A MaxBackoff of
+	// zero means the DefaultMaxBackoff will be used, and one less than
+	// Interval means Interval.
+	MaxBackoff time.Duration
+
+	// Client is used to fetch the feed data. If nil, a client with a 10
+	// second timeout is used.
+	Client *http.Client
+
+	// ConditionalGet, if true, makes requests conditional on the ETag
+	// and Last-Modified of the previous response for each URL, so an
+	// unchanged feed isn't downloaded again.
+	ConditionalGet bool
+
+	mu     sync.Mutex
+	cancel context.CancelFunc // cancels the running monitor
+	done   chan struct{}      // closed when the running monitor returns
+
+	sources [numTypes]source
+
+	subMu sync.Mutex
+	subs  map[chan Update]bool
 }
 
-func (f *Feed) Start() {
-	if f.Interval == 0 {
-		f.Interval = DefaultInterval
+// Type identifies one of the feeds of a Feed.
+type Type int
+
+const (
+	TripUpdates Type = iota
+	VehiclePositions
+	Alerts
+
+	numTypes
+)
+
+var typeNames = []string{"trip_updates", "vehicle_positions", "alerts"}
+
+func (t Type) String() string {
+	if t < 0 || int(t) >= len(typeNames) {
+		return fmt.Sprintf("Type(%d)", int(t))
 	}
+	return typeNames[t]
+}
 
-	go f.monitor()
+// Update describes a newly stored FeedMessage.
+type Update struct {
+	Type    Type
+	Message *gtfsrt.FeedMessage
+
+	// Advanced is true if Message's header timestamp is later than that
+	// of the message it replaced, or if there was none.
+	Advanced bool
 }
 
-func (f *Feed) CurrentTripUpdates() *gtfsrt.FeedMessage {
-	c := f.tripUpdates.Load()
+// Stats counts the outcomes of fetches of one feed.
+type Stats struct {
+	// Fetches is the number of requests made, including failed ones.
+	Fetches int64
+
+	// Stored is the number of messages stored.
+	Stored int64
+
+	// Stale and Duplicate are the number of messages not stored because
+	// their header timestamp was older than, or the same as, that of
+	// the message already held.
+	Stale     int64
+	Duplicate int64
+
+	// NotModified is the number of conditional requests answered with
+	// 304 Not Modified.
+	NotModified int64
+}
+
+// source is the state kept for one feed.
+type source struct {
+	msg atomic.Value
+
+	fetches, stored, stale, duplicate, notModified atomic.Int64
+
+	// only used by the monitor goroutine
+	url, etag, lastModified string
+
+	// protects the fields below, which are only written by the monitor
+	// goroutine
+	mu          sync.Mutex
+	next        time.Time // when to fetch next
+	lastSuccess time.Time
+	lastStored  time.Time
+	lastError   error
+	lastErrorAt time.Time
+	failures    int
+}
+
+func (src *source) current() *gtfsrt.FeedMessage {
+	c := src.msg.Load()
 	if c == nil {
 		return nil
 	}
 	return c.(*gtfsrt.FeedMessage)
 }
 
-func (f *Feed) CurrentVehiclePositions() *gtfsrt.FeedMessage {
-	c := f.vehiclePositions.Load()
-	if c == nil {
-		return nil
+// Stats returns the fetch counters for the feed of type t.
+func (f *Feed) Stats(t Type) Stats {
+	src := &f.sources[t]
+	return Stats{
+		Fetches:     src.fetches.Load(),
+		Stored:      src.stored.Load(),
+		Stale:       src.stale.Load(),
+		Duplicate:   src.duplicate.Load(),
+		NotModified: src.notModified.Load(),
 	}
-	return c.(*gtfsrt.FeedMessage)
 }
 
-func (f *Feed) CurrentAlerts() *gtfsrt.FeedMessage {
-	c := f.alerts.Load()
-	if c == nil {
-		return nil
+// Health describes the state of one feed of a Feed.
+type Health struct {
+	Type Type
+	URL  string
+
+	// LastSuccess is when a fetch last succeeded, whether or not the
+	// message was stored.
+	LastSuccess time.Time
+
+	// LastError and LastErrorAt describe the last failed fetch.
+	LastError   error
+	LastErrorAt time.Time
+
+	// ConsecutiveFailures is the number of fetches that have failed
+	// since the last success.
+	ConsecutiveFailures int
+
+	// DataAge is the time since the header timestamp of the held
+	// message, or since it was stored if it has no timestamp. It is
+	// zero if no message is held.
+	DataAge time.Duration
+
+	// NextFetch is when the feed will next be fetched, later than usual
+	// when backing off after failures.
+	NextFetch time.Time
+}
+
+// Health returns the health of each feed with a URL set, in Type order.
+// It is safe to call while the feed is running.
+func (f *Feed) Health() []Health {
+	now := time.Now()
+	var out []Health
+	for typ, url := range f.urls() {
+		if url == "" {
+			continue
+		}
+		src := &f.sources[typ]
+		m := src.current()
+
+		src.mu.Lock()
+		h := Health{
+			Type:                Type(typ),
+			URL:                 url,
+			LastSuccess:         src.lastSuccess,
+			LastError:           src.lastError,
+			LastErrorAt:         src.lastErrorAt,
+			ConsecutiveFailures: src.failures,
+		}
+		stored := src.lastStored
+		h.NextFetch = src.next
+		src.mu.Unlock()
+
+		if m != nil {
+			if ts := m.GetHeader().GetTimestamp(); ts != 0 {
+				h.DataAge = now.Sub(time.Unix(int64(ts), 0))
+			} else {
+				h.DataAge = now.Sub(stored)
+			}
+		}
+		out = append(out, h)
+	}
+	return out
+}
+
+// subscriptionBuffer is the number of updates a subscriber may fall
+// behind by before updates are dropped.
+const subscriptionBuffer = 16
+
+// Start fetches the feed data every Interval in a new goroutine until
+// Stop is called. It panics with ErrRunning if the feed is already
+// running.
+func (f *Feed) Start() {
+	ctx, end, err := f.begin(context.Background())
+	if err != nil {
+		panic(err)
+	}
+	go func() {
+		defer end()
+		f.monitor(ctx)
+	}()
+}
+
+// Run fetches the feed data every Interval until ctx is done or Stop is
+// called, and returns the context's error. Only one of Run or Start may
+// be active at a time; Run returns ErrRunning if the feed is already
+// running.
+func (f *Feed) Run(ctx context.Context) error {
+	ctx, end, err := f.begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer end()
+	f.monitor(ctx)
+	return ctx.Err()
+}
+
+// Stop cancels any in-flight requests and waits for the goroutine started
+// by Start, or the call to Run, to return. It does nothing if the feed
+// isn't running.
+func (f *Feed) Stop() {
+	f.mu.Lock()
+	cancel, done := f.cancel, f.done
+	f.cancel, f.done = nil, nil
+	f.mu.Unlock()
+
+	if cancel == nil {
+		return
+	}
+	cancel()
+	<-done
+}
+
+// Subscribe returns a channel that receives an Update each time a new
+// FeedMessage is stored, and a function that ends the subscription and
+// closes the channel. The channel is also closed when the feed stops
+// running, after Stop or when Run returns, so ranging over it ends; the
+// function may still be called then. Updates are dropped rather than
+// blocking fetches if the subscriber falls too far behind; the Current
+// methods always return the latest messages.
+func (f *Feed) Subscribe() (<-chan Update, func()) {
+	ch := make(chan Update, subscriptionBuffer)
+
+	f.subMu.Lock()
+	if f.subs == nil {
+		f.subs = make(map[chan Update]bool)
+	}
+	f.subs[ch] = true
+	f.subMu.Unlock()
+
+	return ch, func() {
+		f.subMu.Lock()
+		defer f.subMu.Unlock()
+		if f.subs[ch] {
+			delete(f.subs, ch)
+			close(ch)
+		}
 	}
-	return c.(*gtfsrt.FeedMessage)
+}
+
+// closeSubs ends all subscriptions.
+func (f *Feed) closeSubs() {
+	f.subMu.Lock()
+	defer f.subMu.Unlock()
+
+	for ch := range f.subs {
+		delete(f.subs, ch)
+		close(ch)
+	}
+}
+
+// notify sends u to all subscribers that have room for it.
+func (f *Feed) notify(u Update) {
+	f.subMu.Lock()
+	defer f.subMu.Unlock()
+
+	for ch := range f.subs {
+		select {
+		case ch <- u:
+		default:
+			log.Printf("ns=feed fn=notify type=%s at=dropped", u.Type)
+		}
+	}
+}
+
+// begin records a monitor about to run with a context derived from ctx,
+// returning that context and a function to call when the monitor returns.
+// It returns ErrRunning if a monitor is already running.
+func (f *Feed) begin(ctx context.Context) (context.Context, func(), error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.cancel != nil {
+		return nil, nil, ErrRunning
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	f.cancel, f.done = cancel, done
+
+	return ctx, func() {
+		cancel()
+		f.closeSubs()
+		f.mu.Lock()
+		if f.done == done {
+			// returned without Stop, such as when Run's ctx ended
+			f.cancel, f.done = nil, nil
+		}
+		f.mu.Unlock()
+		close(done)
+	}, nil
+}
+
+func (f *Feed) CurrentTripUpdates() *gtfsrt.FeedMessage {
+	return f.sources[TripUpdates].current()
+}
+
+func (f *Feed) CurrentVehiclePositions() *gtfsrt.FeedMessage {
+	return f.sources[VehiclePositions].current()
+}
+
+func (f *Feed) CurrentAlerts() *gtfsrt.FeedMessage {
+	return f.sources[Alerts].current()
 }
 
 func (f *Feed) StopTimeUpdateForTripAndStop(tripID, stopID string) *gtfsrt.TripUpdate_StopTimeUpdate {
@@ -92,40 +386,145 @@ func (f *Feed) VehiclePositionForTrip(tripID string) *gtfsrt.VehiclePosition {
 	return nil
 }
 
-func (f *Feed) monitor() {
-	tick := time.NewTicker(f.Interval)
-	defer tick.Stop()
+func (f *Feed) monitor(ctx context.Context) {
+	interval, maxBackoff := f.intervals()
+
+	timer := time.NewTimer(0)
+	defer timer.Stop()
 
 	for {
-		f.fetch()
-		<-tick.C
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer.C:
+		}
+
+		now := time.Now()
+		f.fetch(ctx, now, interval, maxBackoff)
+
+		// wake for the earliest fetch due, or after interval if no URLs
+		// are set
+		next := now.Add(interval)
+		for typ, url := range f.urls() {
+			if url != "" && f.sources[typ].next.Before(next) {
+				next = f.sources[typ].next
+			}
+		}
+		timer.Reset(time.Until(next))
+	}
+}
+
+// intervals returns Interval and MaxBackoff with their defaults applied.
+func (f *Feed) intervals() (interval, maxBackoff time.Duration) {
+	interval = f.Interval
+	if interval == 0 {
+		interval = DefaultInterval
+	}
+	maxBackoff = f.MaxBackoff
+	if maxBackoff == 0 {
+		maxBackoff = DefaultMaxBackoff
+	}
+	if maxBackoff < interval {
+		maxBackoff = interval
 	}
+	return interval, maxBackoff
 }
 
-func (f *Feed) fetch() {
-	for _, t := range []struct {
-		v   *atomic.Value
-		url string
-	}{
-		{&f.tripUpdates, f.TripUpdatesURL},
-		{&f.vehiclePositions, f.VehiclePositionsURL},
-		{&f.alerts, f.AlertsURL},
-	} {
-		if t.url == "" {
+// backoff returns how long to wait before retrying after failures
+// consecutive failed fetches: interval doubled for each failure after
+// the first, capped at max, with up to half of it randomly added so
+// clients don't retry in step. It is at least interval if max is.
+func backoff(interval, max time.Duration, failures int) time.Duration {
+	d := interval
+	for i := 1; i < failures && d < max; i++ {
+		d *= 2
+	}
+	if d > max {
+		d = max
+	}
+	return d + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+func (f *Feed) urls() [numTypes]string {
+	return [numTypes]string{
+		TripUpdates:      f.TripUpdatesURL,
+		VehiclePositions: f.VehiclePositionsURL,
+		Alerts:           f.AlertsURL,
+	}
+}
+
+// fetch fetches the feeds due at now, scheduling their next fetches.
+func (f *Feed) fetch(ctx context.Context, now time.Time, interval, maxBackoff time.Duration) {
+	for typ, url := range f.urls() {
+		if url == "" {
+			continue
+		}
+		src := &f.sources[typ]
+		if now.Before(src.next) {
 			continue
 		}
+		if ctx.Err() != nil {
+			return
+		}
 
-		m, err := f.get(t.url)
+		src.fetches.Add(1)
+		m, err := f.get(ctx, src, url)
 		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
 			// logged by get
+			src.mu.Lock()
+			src.lastError, src.lastErrorAt = err, time.Now()
+			src.failures++
+			wait := backoff(interval, maxBackoff, src.failures)
+			src.next = now.Add(wait)
+			log.Printf("ns=feed fn=fetch url=%q at=backoff failures=%d wait=%s", url, src.failures, wait.Round(time.Millisecond))
+			src.mu.Unlock()
+			continue
+		}
+
+		src.mu.Lock()
+		src.lastSuccess = time.Now()
+		src.failures = 0
+		src.next = now.Add(interval)
+		src.mu.Unlock()
+
+		if m == nil {
+			src.notModified.Add(1)
 			continue
 		}
 
-		t.v.Store(m)
+		// messages without a timestamp can't be compared so are always
+		// stored
+		ts := m.GetHeader().GetTimestamp()
+		prev := src.current()
+		if pts := prev.GetHeader().GetTimestamp(); ts != 0 && pts != 0 {
+			switch {
+			case ts < pts:
+				src.stale.Add(1)
+				log.Printf("ns=feed fn=fetch url=%q at=stale timestamp=%d held=%d", url, ts, pts)
+				continue
+			case ts == pts:
+				src.duplicate.Add(1)
+				continue
+			}
+		}
+
+		src.msg.Store(m)
+		src.stored.Add(1)
+		src.mu.Lock()
+		src.lastStored = time.Now()
+		src.mu.Unlock()
+		f.notify(Update{
+			Type:     Type(typ),
+			Message:  m,
+			Advanced: prev == nil || ts > prev.GetHeader().GetTimestamp(),
+		})
 	}
 }
 
-var client = &http.Client{
+var defaultClient = &http.Client{
 	Timeout: 10 * time.Second,
 	Transport: &http.Transport{
 		DialContext: (&net.Dialer{
@@ -139,17 +538,55 @@ var client = &http.Client{
 	},
 }
 
-func (f *Feed) get(url string) (*gtfsrt.FeedMessage, error) {
-	resp, err := client.Get(url)
+// get fetches and parses the feed at url, returning a nil message if
+// the request was conditional and the feed hasn't changed.
+func (f *Feed) get(ctx context.Context, src *source, url string) (*gtfsrt.FeedMessage, error) {
+	client := f.Client
+	if client == nil {
+		client = defaultClient
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
 	if err != nil {
 		log.Printf("ns=feed fn=get url=%q at=err err=%q", url, err)
 		return nil, err
 	}
+	if src.url != url {
+		src.url, src.etag, src.lastModified = url, "", ""
+	}
+	if f.ConditionalGet {
+		if src.etag != "" {
+			req.Header.Set("If-None-Match", src.etag)
+		}
+		if src.lastModified != "" {
+			req.Header.Set("If-Modified-Since", src.lastModified)
+		}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		if ctx.Err() == nil {
+			log.Printf("ns=feed fn=get url=%q at=err err=%q", url, err)
+		}
+		return nil, err
+	}
 	defer resp.Body.Close()
 
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotModified:
+		log.Printf("ns=feed fn=get url=%q at=not-modified", url)
+		return nil, nil
+	default:
+		err := fmt.Errorf("unexpected status %s", resp.Status)
+		log.Printf("ns=feed fn=get url=%q at=err err=%q", url, err)
+		return nil, err
+	}
+
 	b, err := io.ReadAll(resp.Body)
 	if err != nil {
-		log.Printf("ns=feed fn=get url=%q at=err err=%q", url, err)
+		if ctx.Err() == nil {
+			log.Printf("ns=feed fn=get url=%q at=err err=%q", url, err)
+		}
 		return nil, err
 	}
 
@@ -158,6 +595,7 @@ func (f *Feed) get(url string) (*gtfsrt.FeedMessage, error) {
 		log.Printf("ns=feed fn=get url=%q at=err err=%q", url, err)
 		return nil, err
 	}
+	src.etag, src.lastModified = resp.Header.Get("ETag"), resp.Header.Get("Last-Modified")
 
 	age := int(time.Since(time.Unix(int64(m.GetHeader().GetTimestamp()), 0)).Seconds())
 	log.Printf("ns=feed fn=get url=%q at=done items=%d age=%d", url, len(m.GetEntity()), age)
@@ -0,0 +1,338 @@
+package feed
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/danp/catchbus/gtfs/gtfsrt"
+	"google.golang.org/protobuf/proto"
+)
+
+// message returns an encoded FeedMessage with header timestamp ts, or no
+// timestamp if ts is zero.
+func message(t *testing.T, ts uint64) []byte {
+	t.Helper()
+
+	h := &gtfsrt.FeedHeader{GtfsRealtimeVersion: proto.String("2.0")}
+	if ts != 0 {
+		h.Timestamp = proto.Uint64(ts)
+	}
+	b, err := proto.Marshal(&gtfsrt.FeedMessage{Header: h})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestStopDuringRequest(t *testing.T) {
+	started := make(chan struct{}, 1)
+	canceled := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		started <- struct{}{}
+		<-r.Context().Done()
+		close(canceled)
+	}))
+	defer srv.Close()
+
+	f := &Feed{TripUpdatesURL: srv.URL, Client: srv.Client()}
+	f.Start()
+	<-started
+
+	stopped := make(chan struct{})
+	go func() {
+		f.Stop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Stop blocked on the in-flight request")
+	}
+	select {
+	case <-canceled:
+	case <-time.After(5 * time.Second):
+		t.Fatal("in-flight request not canceled")
+	}
+
+	// stopping again does nothing
+	f.Stop()
+}
+
+// running reports whether f has a monitor running.
+func running(f *Feed) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.cancel != nil
+}
+
+func TestRunning(t *testing.T) {
+	b := message(t, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(b)
+	}))
+	defer srv.Close()
+
+	f := &Feed{TripUpdatesURL: srv.URL, Interval: time.Millisecond}
+	f.Start()
+	if err := f.Run(context.Background()); err != ErrRunning {
+		t.Errorf("Run while started: got %v, want ErrRunning", err)
+	}
+	func() {
+		defer func() {
+			if r := recover(); r != ErrRunning {
+				t.Errorf("Start while started: got panic %v, want ErrRunning", r)
+			}
+		}()
+		f.Start()
+	}()
+	f.Stop()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := f.Run(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Run: got %v, want %v", err, context.DeadlineExceeded)
+	}
+	if running(f) {
+		t.Error("still running after Run returned")
+	}
+
+	// Run returning on its own leaves the feed free to run again
+	done := make(chan error)
+	go func() { done <- f.Run(context.Background()) }()
+	for !running(f) {
+		time.Sleep(time.Millisecond)
+	}
+	f.Stop()
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Errorf("Run after Stop: got %v, want %v", err, context.Canceled)
+	}
+}
+
+// serve returns a server answering each request with the next of bodies,
+// repeating the last.
+func serve(t *testing.T, bodies ...[]byte) *httptest.Server {
+	t.Helper()
+
+	var mu sync.Mutex
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		b := bodies[0]
+		if len(bodies) > 1 {
+			bodies = bodies[1:]
+		}
+		mu.Unlock()
+		w.Write(b)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// fetcher returns a function fetching f's feeds once as the monitor
+// would, each time an hour after the last so every feed is due, and
+// returning the time it fetched at.
+func fetcher(f *Feed, interval, maxBackoff time.Duration) func() time.Time {
+	now := time.Now()
+	return func() time.Time {
+		now = now.Add(time.Hour)
+		f.fetch(context.Background(), now, interval, maxBackoff)
+		return now
+	}
+}
+
+func TestSubscribe(t *testing.T) {
+	srv := serve(t, message(t, 1), message(t, 0), message(t, 2), message(t, 0))
+	f := &Feed{VehiclePositionsURL: srv.URL}
+	ch, cancel := f.Subscribe()
+
+	fetch := fetcher(f, time.Second, time.Minute)
+	for _, want := range []bool{true, false, true, false} {
+		fetch()
+		select {
+		case u := <-ch:
+			if u.Type != VehiclePositions || u.Message != f.CurrentVehiclePositions() {
+				t.Errorf("got update of %v, want the held %v", u.Type, VehiclePositions)
+			}
+			if u.Advanced != want {
+				t.Errorf("timestamp %d: got Advanced %v, want %v", u.Message.GetHeader().GetTimestamp(), u.Advanced, want)
+			}
+		default:
+			t.Fatal("no update sent")
+		}
+	}
+
+	cancel()
+	cancel()
+	if _, ok := <-ch; ok {
+		t.Error("channel not closed by cancel")
+	}
+}
+
+func TestSubscribeClosedOnStop(t *testing.T) {
+	f := &Feed{}
+	ch, cancel := f.Subscribe()
+	defer cancel()
+
+	ctx, cancelCtx := context.WithCancel(context.Background())
+	cancelCtx()
+	f.Run(ctx)
+
+	select {
+	case _, ok := <-ch:
+		if ok {
+			t.Error("got update, want closed channel")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("channel not closed when Run returned")
+	}
+}
+
+func TestStats(t *testing.T) {
+	var bodies [][]byte
+	for _, ts := range []uint64{1000, 1001, 1001, 999, 1002, 0} {
+		bodies = append(bodies, message(t, ts))
+	}
+	srv := serve(t, bodies...)
+	f := &Feed{TripUpdatesURL: srv.URL}
+
+	fetch := fetcher(f, time.Second, time.Minute)
+	for range bodies {
+		fetch()
+	}
+
+	want := Stats{Fetches: 6, Stored: 4, Stale: 1, Duplicate: 1}
+	if got := f.Stats(TripUpdates); got != want {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+	if ts := f.CurrentTripUpdates().GetHeader().GetTimestamp(); ts != 0 {
+		t.Errorf("held message has timestamp %d, want none", ts)
+	}
+}
+
+func TestConditionalGet(t *testing.T) {
+	b := message(t, 1000)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		w.Write(b)
+	}))
+	defer srv.Close()
+	f := &Feed{AlertsURL: srv.URL, ConditionalGet: true}
+
+	fetch := fetcher(f, time.Second, time.Minute)
+	for i := 0; i < 3; i++ {
+		fetch()
+	}
+
+	want := Stats{Fetches: 3, Stored: 1, NotModified: 2}
+	if got := f.Stats(Alerts); got != want {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+	if f.CurrentAlerts() == nil {
+		t.Error("304 dropped the held message")
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	const interval, max = 10 * time.Second, time.Minute
+	for _, tc := range []struct {
+		failures int
+		base     time.Duration
+	}{
+		{1, interval},
+		{2, 2 * interval},
+		{3, 4 * interval},
+		{4, max},
+		{10, max},
+	} {
+		for i := 0; i < 100; i++ {
+			if d := backoff(interval, max, tc.failures); d < tc.base || d > tc.base+tc.base/2 {
+				t.Fatalf("%d failures: got %s, want within [%s, %s]", tc.failures, d, tc.base, tc.base+tc.base/2)
+			}
+		}
+	}
+}
+
+func TestIntervals(t *testing.T) {
+	for _, tc := range []struct {
+		setInterval, setMaxBackoff time.Duration
+		interval, maxBackoff       time.Duration
+	}{
+		{0, 0, DefaultInterval, DefaultMaxBackoff},
+		{time.Minute, time.Hour, time.Minute, time.Hour},
+		{time.Hour, 0, time.Hour, time.Hour},
+		{time.Minute, time.Second, time.Minute, time.Minute},
+	} {
+		f := &Feed{Interval: tc.setInterval, MaxBackoff: tc.setMaxBackoff}
+		interval, maxBackoff := f.intervals()
+		if interval != tc.interval || maxBackoff != tc.maxBackoff {
+			t.Errorf("Interval %s, MaxBackoff %s: got %s, %s, want %s, %s", tc.setInterval, tc.setMaxBackoff, interval, maxBackoff, tc.interval, tc.maxBackoff)
+		}
+	}
+}
+
+func TestHealth(t *testing.T) {
+	var failing atomic.Bool
+	failing.Store(true)
+	ts := uint64(time.Now().Add(-30 * time.Second).Unix())
+	b := message(t, ts)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if failing.Load() {
+			http.Error(w, "down", http.StatusServiceUnavailable)
+			return
+		}
+		w.Write(b)
+	}))
+	defer srv.Close()
+
+	if h := (&Feed{}).Health(); len(h) != 0 {
+		t.Errorf("got health %+v for a feed without URLs", h)
+	}
+
+	const interval, max = time.Second, 10 * time.Second
+	f := &Feed{TripUpdatesURL: srv.URL}
+	fetch := fetcher(f, interval, max)
+
+	// each failure waits longer, up to max plus jitter
+	var last time.Duration
+	for i := 1; i <= 6; i++ {
+		now := fetch()
+		hs := f.Health()
+		if len(hs) != 1 {
+			t.Fatalf("got %d healths, want 1", len(hs))
+		}
+		h := hs[0]
+		if h.Type != TripUpdates || h.URL != srv.URL {
+			t.Errorf("got health for %v %q, want %v %q", h.Type, h.URL, TripUpdates, srv.URL)
+		}
+		if h.ConsecutiveFailures != i || h.LastError == nil || h.LastErrorAt.IsZero() || !h.LastSuccess.IsZero() || h.DataAge != 0 {
+			t.Errorf("after %d failures got %+v", i, h)
+		}
+		wait := h.NextFetch.Sub(now)
+		if wait < interval || wait > max+max/2 || (i <= 3 && wait <= last) {
+			t.Errorf("after %d failures waiting %s, previously %s", i, wait, last)
+		}
+		last = wait
+	}
+
+	failing.Store(false)
+	now := fetch()
+	h := f.Health()[0]
+	if h.ConsecutiveFailures != 0 || h.LastSuccess.IsZero() || h.LastError == nil {
+		t.Errorf("after recovery got %+v", h)
+	}
+	if wait := h.NextFetch.Sub(now); wait != interval {
+		t.Errorf("after recovery waiting %s, want %s", wait, interval)
+	}
+	if h.DataAge < 30*time.Second || h.DataAge > time.Minute {
+		t.Errorf("got DataAge %s, want about 30s", h.DataAge)
+	}
+}
@@ -0,0 +1,130 @@
+package gtfs
+
+import (
+	"sort"
+	"time"
+)
+
+// Headways summarizes scheduled departures on a service date. Times are
+// durations since noon minus 12h on the date, as in StopTime.
+type Headways struct {
+	// From and To are the window, departures in [From, To).
+	From, To time.Duration
+
+	// Departures are the departures within the requested window, in
+	// order.
+	Departures []time.Duration
+
+	// Gaps are the times between consecutive Departures.
+	Gaps []time.Duration
+
+	// Mean and Max summarize Gaps. They are zero with fewer than two
+	// departures in the window.
+	Mean time.Duration
+	Max  time.Duration
+
+	// First and Last are the first and last departures of the whole
+	// service date, regardless of the window, giving the span of
+	// service. Both are zero if there are no departures.
+	First time.Duration
+	Last  time.Duration
+}
+
+// Span returns the span of service, from the first to the last
+// departure of the service date.
+func (h Headways) Span() time.Duration {
+	return h.Last - h.First
+}
+
+// PerHour returns the number of departures per hour in the window.
+func (h Headways) PerHour() float64 {
+	if h.To <= h.From {
+		return 0
+	}
+	return float64(len(h.Departures)) / (h.To - h.From).Hours()
+}
+
+// StopHeadways returns the headways of departures from the stop with the
+// given ID on service date d, with the window being departures in
+// [from, to). If routeID is not empty only trips of that route are
+// considered. Stop times that do not allow pickup, or that end their
+// trip, are ignored. FillMaps must have been called.
+func (s *Static) StopHeadways(stopID, routeID string, d time.Time, from, to time.Duration) Headways {
+	active := s.ActiveServicesForDate(d)
+
+	var deps []time.Duration
+	for _, st := range s.StopTimesForStop(stopID) {
+		if st.PickupType == PickupDropOffNone {
+			continue
+		}
+		t, ok := s.TripIDsToTrips[st.TripID]
+		if !ok || !active[t.ServiceID] {
+			continue
+		}
+		if routeID != "" && t.RouteID != routeID {
+			continue
+		}
+		if last, ok := s.StopTimeTable.lastSequence(st.TripID); ok && st.StopSequence == last {
+			continue
+		}
+		deps = append(deps, st.DepartureTime)
+	}
+
+	return NewHeadways(deps, from, to)
+}
+
+// RouteHeadways returns the headways of trips of the route with the
+// given ID and direction on service date d, measured by when each trip
+// departs its first stop, with the window being trips starting in
+// [from, to). FillMaps must have been called.
+func (s *Static) RouteHeadways(routeID string, directionID int, d time.Time, from, to time.Duration) Headways {
+	active := s.ActiveServicesForDate(d)
+
+	var deps []time.Duration
+	for _, t := range s.Trips {
+		if t.RouteID != routeID || t.DirectionID != directionID || !active[t.ServiceID] {
+			continue
+		}
+		sts := s.StopTimesForTrip(t.ID)
+		if len(sts) == 0 {
+			continue
+		}
+		deps = append(deps, sts[0].DepartureTime)
+	}
+	return NewHeadways(deps, from, to)
+}
+
+// NewHeadways summarizes the departure times deps, with the window being
+// departures in [from, to). deps is sorted in place. It is useful for
+// departures already collected by other means, saving the scans of
+// StopHeadways and RouteHeadways.
+func NewHeadways(deps []time.Duration, from, to time.Duration) Headways {
+	sort.Slice(deps, func(i, j int) bool { return deps[i] < deps[j] })
+
+	h := Headways{From: from, To: to}
+	if len(deps) == 0 {
+		return h
+	}
+	h.First, h.Last = deps[0], deps[len(deps)-1]
+
+	for _, dep := range deps {
+		if dep >= from && dep < to {
+			h.Departures = append(h.Departures, dep)
+		}
+	}
+
+	var sum time.Duration
+	for i := 1; i < len(h.Departures); i++ {
+		g := h.Departures[i] - h.Departures[i-1]
+		h.Gaps = append(h.Gaps, g)
+		sum += g
+		if g > h.Max {
+			h.Max = g
+		}
+	}
+	if len(h.Gaps) > 0 {
+		h.Mean = sum / time.Duration(len(h.Gaps))
+	}
+
+	return h
+}
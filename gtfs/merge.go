@@ -0,0 +1,386 @@
+package gtfs
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// MergeOptions configures Merge.
+type MergeOptions struct {
+	// Prefixes holds, for each feed, the prefix added to IDs that collide
+	// with a different entity from an earlier feed.
+	// If nil, feed i uses the prefix "<i+1>_".
+	Prefixes []string
+
+	// StopTolerance is the distance in meters within which stops from
+	// different feeds with the same name are merged into one.
+	// A StopTolerance of zero disables merging stops by location.
+	StopTolerance float64
+}
+
+// Merge combines feeds into a single Static.
+//
+// Entities from later feeds whose IDs collide with an earlier feed's
+// are dropped if they are identical, with references to them pointed
+// at the earlier entity, and otherwise given an ID prefixed per
+// opts.Prefixes. All agencies must share a time zone.
+//
+// FillMaps must have been called on each feed. It is not called on the
+// result.
+func Merge(feeds []*Static, opts MergeOptions) (*Static, error) {
+	if opts.Prefixes != nil && len(opts.Prefixes) != len(feeds) {
+		return nil, fmt.Errorf("got %d prefixes for %d feeds", len(opts.Prefixes), len(feeds))
+	}
+
+	m := &merger{
+		out:       &Static{},
+		opts:      opts,
+		agencies:  make(map[string]int),
+		stops:     make(map[string]int),
+		stopNames: make(map[string][]int),
+		routes:    make(map[string]int),
+		services:  make(map[string]string),
+		shapes:    make(map[string]string),
+		trips:     make(map[string]int),
+		tripSTs:   make(map[string][]StopTime),
+		blocks:    make(map[string]bool),
+		transfers: make(map[Transfer]bool),
+	}
+
+	for i, f := range feeds {
+		prefix := fmt.Sprintf("%d_", i+1)
+		if opts.Prefixes != nil {
+			prefix = opts.Prefixes[i]
+		}
+		if err := m.add(f, prefix); err != nil {
+			return nil, err
+		}
+	}
+
+	return m.out, nil
+}
+
+type merger struct {
+	out  *Static
+	opts MergeOptions
+
+	// IDs in out to their index in the corresponding out slice, or to a
+	// key describing the entity for services and shapes
+	agencies  map[string]int
+	stops     map[string]int
+	stopNames map[string][]int
+	routes    map[string]int
+	services  map[string]string
+	shapes    map[string]string
+	trips     map[string]int
+	tripSTs   map[string][]StopTime
+	blocks    map[string]bool
+	transfers map[Transfer]bool
+}
+
+// feedIDs maps IDs in the feed being added to IDs in the merged feed.
+type feedIDs struct {
+	agencies map[string]string
+	stops    map[string]string
+	routes   map[string]string
+	services map[string]string
+	shapes   map[string]string
+	trips    map[string]string
+	blocks   map[string]string
+}
+
+// uniqueID returns id, or id with prefix added, such that it is not in taken.
+func uniqueID(id, prefix string, taken func(string) bool) string {
+	if !taken(id) {
+		return id
+	}
+	nid := prefix + id
+	for n := 2; taken(nid); n++ {
+		nid = fmt.Sprintf("%s%s_%d", prefix, id, n)
+	}
+	return nid
+}
+
+func (m *merger) add(f *Static, prefix string) error {
+	if len(m.out.Agencies) > 0 && len(f.Agencies) > 0 &&
+		m.out.Agencies[0].Timezone.String() != f.Agencies[0].Timezone.String() {
+		return fmt.Errorf("agencies %s (%s) and %s (%s) have different time zones",
+			m.out.Agencies[0].Name, m.out.Agencies[0].Timezone,
+			f.Agencies[0].Name, f.Agencies[0].Timezone)
+	}
+
+	ids := feedIDs{
+		agencies: make(map[string]string),
+		stops:    make(map[string]string),
+		routes:   make(map[string]string),
+		services: make(map[string]string),
+		shapes:   make(map[string]string),
+		trips:    make(map[string]string),
+		blocks:   make(map[string]string),
+	}
+
+	m.addAgencies(f, prefix, ids)
+	m.addStops(f, prefix, ids)
+	m.addRoutes(f, prefix, ids)
+	m.addServices(f, prefix, ids)
+	m.addShapes(f, prefix, ids)
+	m.addTrips(f, prefix, ids)
+	m.addTransfers(f, ids)
+
+	return nil
+}
+
+func (m *merger) addAgencies(f *Static, prefix string, ids feedIDs) {
+	for _, a := range f.Agencies {
+		oid := a.ID
+		if a.ID == "" {
+			// routes may omit agency_id when there is only one agency,
+			// which won't hold once merged
+			a.ID = prefix + "agency"
+		}
+		if i, ok := m.agencies[a.ID]; ok && len(diffFields(m.out.Agencies[i], a)) == 0 {
+			ids.agencies[oid] = a.ID
+			continue
+		}
+		a.ID = uniqueID(a.ID, prefix, func(id string) bool { _, ok := m.agencies[id]; return ok })
+		ids.agencies[oid] = a.ID
+		m.agencies[a.ID] = len(m.out.Agencies)
+		m.out.Agencies = append(m.out.Agencies, a)
+	}
+}
+
+func normalizeStopName(n string) string {
+	return strings.Join(strings.Fields(strings.ToLower(n)), " ")
+}
+
+func (m *merger) addStops(f *Static, prefix string, ids feedIDs) {
+	var added []int
+
+	for _, st := range f.Stops {
+		if i, ok := m.stops[st.ID]; ok && m.out.Stops[i] == st {
+			ids.stops[st.ID] = st.ID
+			continue
+		}
+
+		if m.opts.StopTolerance > 0 && st.Point != NoPoint {
+			if i, ok := m.nearbyStop(st); ok {
+				ids.stops[st.ID] = m.out.Stops[i].ID
+				continue
+			}
+		}
+
+		oid := st.ID
+		st.ID = uniqueID(st.ID, prefix, func(id string) bool { _, ok := m.stops[id]; return ok })
+		ids.stops[oid] = st.ID
+		m.stops[st.ID] = len(m.out.Stops)
+		added = append(added, len(m.out.Stops))
+		m.out.Stops = append(m.out.Stops, st)
+	}
+
+	// parent stations can appear after their children
+	for _, i := range added {
+		st := &m.out.Stops[i]
+		if st.ParentStation != "" {
+			if nid, ok := ids.stops[st.ParentStation]; ok {
+				st.ParentStation = nid
+			}
+		}
+		n := normalizeStopName(st.Name)
+		m.stopNames[n] = append(m.stopNames[n], i)
+	}
+}
+
+func (m *merger) nearbyStop(st Stop) (int, bool) {
+	best, bestDist := -1, m.opts.StopTolerance
+	for _, i := range m.stopNames[normalizeStopName(st.Name)] {
+		o := m.out.Stops[i]
+		if o.LocationType != st.LocationType {
+			continue
+		}
+		if d := o.Point.DistanceTo(st.Point); d <= bestDist {
+			best, bestDist = i, d
+		}
+	}
+	return best, best >= 0
+}
+
+func (m *merger) addRoutes(f *Static, prefix string, ids feedIDs) {
+	for _, r := range f.Routes {
+		if nid, ok := ids.agencies[r.AgencyID]; ok {
+			r.AgencyID = nid
+		} else if r.AgencyID == "" && len(f.Agencies) == 1 {
+			r.AgencyID = ids.agencies[f.Agencies[0].ID]
+		}
+
+		if i, ok := m.routes[r.ID]; ok && m.out.Routes[i] == r {
+			ids.routes[r.ID] = r.ID
+			continue
+		}
+		oid := r.ID
+		r.ID = uniqueID(r.ID, prefix, func(id string) bool { _, ok := m.routes[id]; return ok })
+		ids.routes[oid] = r.ID
+		m.routes[r.ID] = len(m.out.Routes)
+		m.out.Routes = append(m.out.Routes, r)
+	}
+}
+
+func (m *merger) addServices(f *Static, prefix string, ids feedIDs) {
+	// a service is identified by its calendar entry and exception dates
+	cals := make(map[string]Calendar)
+	dates := make(map[string][]CalendarDate)
+	var order []string
+	for _, c := range f.Calendar {
+		cals[c.ServiceID] = c
+		order = append(order, c.ServiceID)
+	}
+	for _, c := range f.CalendarDates {
+		if _, ok := cals[c.ServiceID]; !ok && dates[c.ServiceID] == nil {
+			order = append(order, c.ServiceID)
+		}
+		dates[c.ServiceID] = append(dates[c.ServiceID], c)
+	}
+
+	for _, sid := range order {
+		if _, ok := ids.services[sid]; ok {
+			continue
+		}
+
+		var key strings.Builder
+		if c, ok := cals[sid]; ok {
+			rec := calendarRecord(c)
+			key.WriteString(strings.Join(rec[1:], ","))
+		}
+		ds := dates[sid]
+		sort.Slice(ds, func(i, j int) bool { return ds[i].Date.Before(ds[j].Date) })
+		for _, d := range ds {
+			fmt.Fprintf(&key, "|%s:%d", FormatDate(d.Date), d.ExceptionType)
+		}
+
+		if k, ok := m.services[sid]; ok && k == key.String() {
+			ids.services[sid] = sid
+			continue
+		}
+
+		nid := uniqueID(sid, prefix, func(id string) bool { _, ok := m.services[id]; return ok })
+		ids.services[sid] = nid
+		m.services[nid] = key.String()
+
+		if c, ok := cals[sid]; ok {
+			c.ServiceID = nid
+			m.out.Calendar = append(m.out.Calendar, c)
+		}
+		for _, d := range ds {
+			d.ServiceID = nid
+			m.out.CalendarDates = append(m.out.CalendarDates, d)
+		}
+	}
+}
+
+func (m *merger) addShapes(f *Static, prefix string, ids feedIDs) {
+	ordered := make([]string, 0, len(f.ShapeIDsToShapes))
+	for id := range f.ShapeIDsToShapes {
+		ordered = append(ordered, id)
+	}
+	sort.Strings(ordered)
+
+	for _, sid := range ordered {
+		pts := f.ShapeIDsToShapes[sid]
+
+		var key strings.Builder
+		for _, p := range pts {
+			rec := shapeRecord(p)
+			key.WriteString(strings.Join(rec[1:], ","))
+			key.WriteByte('|')
+		}
+
+		if k, ok := m.shapes[sid]; ok && k == key.String() {
+			ids.shapes[sid] = sid
+			continue
+		}
+
+		nid := uniqueID(sid, prefix, func(id string) bool { _, ok := m.shapes[id]; return ok })
+		ids.shapes[sid] = nid
+		m.shapes[nid] = key.String()
+		for _, p := range pts {
+			p.ID = nid
+			m.out.Shapes = append(m.out.Shapes, p)
+		}
+	}
+}
+
+func (m *merger) addTrips(f *Static, prefix string, ids feedIDs) {
+	for _, t := range f.Trips {
+		t.RouteID = mapID(ids.routes, t.RouteID)
+		t.ServiceID = mapID(ids.services, t.ServiceID)
+		if t.ShapeID != "" {
+			t.ShapeID = mapID(ids.shapes, t.ShapeID)
+		}
+
+		sts := f.StopTimesForTrip(t.ID)
+		for i := range sts {
+			sts[i].StopID = mapID(ids.stops, sts[i].StopID)
+		}
+
+		if i, ok := m.trips[t.ID]; ok && m.out.Trips[i] == t && stopTimesEqual(m.tripSTs[t.ID], sts) {
+			ids.trips[t.ID] = t.ID
+			continue
+		}
+
+		oid := t.ID
+		t.ID = uniqueID(t.ID, prefix, func(id string) bool { _, ok := m.trips[id]; return ok })
+		ids.trips[oid] = t.ID
+		if t.BlockID != "" {
+			// keep blocks from joining another feed's with the same ID
+			nb, ok := ids.blocks[t.BlockID]
+			if !ok {
+				nb = uniqueID(t.BlockID, prefix, func(id string) bool { return m.blocks[id] })
+				ids.blocks[t.BlockID] = nb
+				m.blocks[nb] = true
+			}
+			t.BlockID = nb
+		}
+		for i := range sts {
+			sts[i].TripID = t.ID
+		}
+
+		m.trips[t.ID] = len(m.out.Trips)
+		m.tripSTs[t.ID] = sts
+		m.out.Trips = append(m.out.Trips, t)
+		for _, st := range sts {
+			m.out.StopTimeTable.Append(st)
+		}
+	}
+}
+
+func (m *merger) addTransfers(f *Static, ids feedIDs) {
+	for _, t := range f.Transfers {
+		t.FromStopID = mapID(ids.stops, t.FromStopID)
+		t.ToStopID = mapID(ids.stops, t.ToStopID)
+		if t.FromRouteID != "" {
+			t.FromRouteID = mapID(ids.routes, t.FromRouteID)
+		}
+		if t.ToRouteID != "" {
+			t.ToRouteID = mapID(ids.routes, t.ToRouteID)
+		}
+		if t.FromTripID != "" {
+			t.FromTripID = mapID(ids.trips, t.FromTripID)
+		}
+		if t.ToTripID != "" {
+			t.ToTripID = mapID(ids.trips, t.ToTripID)
+		}
+
+		if m.transfers[t] {
+			continue
+		}
+		m.transfers[t] = true
+		m.out.Transfers = append(m.out.Transfers, t)
+	}
+}
+
+func mapID(ids map[string]string, id string) string {
+	if nid, ok := ids[id]; ok {
+		return nid
+	}
+	return id
+}
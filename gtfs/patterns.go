@@ -0,0 +1,163 @@
+package gtfs
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// RouteDirection describes the trips of a route in one direction.
+type RouteDirection struct {
+	DirectionID int
+
+	// StopIDs is the canonical order of all stops served in this
+	// direction, suitable for drawing a route diagram. It follows the main
+	// pattern, with stops only served by variants inserted after the stop
+	// that precedes them in the variant.
+	StopIDs []string
+
+	// Patterns holds the distinct stop patterns, main pattern first and
+	// then by decreasing trip count.
+	Patterns []Pattern
+}
+
+// Pattern is a distinct sequence of stops served by trips of a route in
+// one direction.
+type Pattern struct {
+	// ID is the route ID, direction ID and the pattern's index in
+	// RouteDirection.Patterns, joined by colons.
+	ID          string
+	RouteID     string
+	DirectionID int
+	StopIDs     []string
+	TripIDs     []string
+
+	// ShapeID is the shape used by most of the pattern's trips, or empty
+	// if none of them have one.
+	ShapeID string
+
+	// Headsign is the headsign used by most of the pattern's trips.
+	Headsign string
+
+	// Main is true for the pattern with the most trips in its direction;
+	// the others are variants.
+	Main bool
+}
+
+// RouteDirections groups the trips of the route with the given ID into
+// patterns by direction, ordered by direction ID. FillMaps must have been
+// called.
+func (s *Static) RouteDirections(routeID string) []RouteDirection {
+	type key struct {
+		dir   int
+		stops string
+	}
+	byKey := make(map[key]*Pattern)
+
+	for _, t := range s.Trips {
+		if t.RouteID != routeID {
+			continue
+		}
+
+		sts := s.StopTimesForTrip(t.ID)
+		if len(sts) == 0 {
+			continue
+		}
+		stopIDs := make([]string, len(sts))
+		for i, st := range sts {
+			stopIDs[i] = st.StopID
+		}
+
+		k := key{t.DirectionID, strings.Join(stopIDs, "\x00")}
+		p, ok := byKey[k]
+		if !ok {
+			p = &Pattern{RouteID: routeID, DirectionID: t.DirectionID, StopIDs: stopIDs}
+			byKey[k] = p
+		}
+		p.TripIDs = append(p.TripIDs, t.ID)
+	}
+
+	byDir := make(map[int][]Pattern)
+	for _, p := range byKey {
+		sort.Strings(p.TripIDs)
+		p.ShapeID = s.mostCommonTripField(p.TripIDs, func(t *Trip) string { return t.ShapeID })
+		p.Headsign = s.mostCommonTripField(p.TripIDs, func(t *Trip) string { return t.Headsign })
+		byDir[p.DirectionID] = append(byDir[p.DirectionID], *p)
+	}
+
+	out := make([]RouteDirection, 0, len(byDir))
+	for dir, ps := range byDir {
+		sort.Slice(ps, func(i, j int) bool {
+			if len(ps[i].TripIDs) != len(ps[j].TripIDs) {
+				return len(ps[i].TripIDs) > len(ps[j].TripIDs)
+			}
+			if len(ps[i].StopIDs) != len(ps[j].StopIDs) {
+				return len(ps[i].StopIDs) > len(ps[j].StopIDs)
+			}
+			return ps[i].TripIDs[0] < ps[j].TripIDs[0]
+		})
+
+		for i := range ps {
+			ps[i].ID = routeID + ":" + strconv.Itoa(dir) + ":" + strconv.Itoa(i)
+			ps[i].Main = i == 0
+		}
+
+		out = append(out, RouteDirection{
+			DirectionID: dir,
+			StopIDs:     canonicalStops(ps),
+			Patterns:    ps,
+		})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].DirectionID < out[j].DirectionID })
+
+	return out
+}
+
+// mostCommonTripField returns the most common non-empty value of field
+// among the trips with the given IDs, breaking ties by value.
+func (s *Static) mostCommonTripField(tripIDs []string, field func(*Trip) string) string {
+	counts := make(map[string]int)
+	for _, id := range tripIDs {
+		if t, ok := s.TripIDsToTrips[id]; ok {
+			if v := field(t); v != "" {
+				counts[v]++
+			}
+		}
+	}
+
+	var best string
+	for v, n := range counts {
+		if n > counts[best] || (n == counts[best] && v < best) {
+			best = v
+		}
+	}
+	return best
+}
+
+// canonicalStops merges the stop lists of ps, starting with the first.
+func canonicalStops(ps []Pattern) []string {
+	var out []string
+	for _, p := range ps {
+		pos := -1 // index in out of the last stop of p seen
+		for _, id := range p.StopIDs {
+			if i := indexAfter(out, id, pos); i >= 0 {
+				pos = i
+				continue
+			}
+			pos++
+			out = append(out[:pos], append([]string{id}, out[pos:]...)...)
+		}
+	}
+	return out
+}
+
+// indexAfter returns the index of the first id in s after index after,
+// or -1.
+func indexAfter(s []string, id string, after int) int {
+	for i := after + 1; i < len(s); i++ {
+		if s[i] == id {
+			return i
+		}
+	}
+	return -1
+}
@@ -2,13 +2,17 @@ package gtfs
 
 import (
 	"archive/zip"
+	"bufio"
+	"bytes"
 	"encoding/csv"
 	"errors"
 	"fmt"
 	"io"
 	"os"
+	"runtime"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -27,77 +31,193 @@ func ReadZipFile(path string) (*Static, error) {
 	return ReadZip(f, st.Size())
 }
 
+// ReadOptions configures ReadZipWithOptions.
+type ReadOptions struct {
+	// StopTimeWorkers is the number of goroutines parsing rows of
+	// stop_times.txt, usually by far the largest file.
+	// Zero means runtime.GOMAXPROCS(0). One parses rows as they are read.
+	StopTimeWorkers int
+
+	// StopTimeRows also fills the deprecated Static.StopTimes, and so
+	// its maps filled by FillMaps, for code not yet using
+	// Static.StopTimeTable. It keeps a second, several times larger copy
+	// of every stop time.
+	StopTimeRows bool
+}
+
+// ReadZip reads a GTFS zip with the default ReadOptions.
 func ReadZip(r io.ReaderAt, size int64) (*Static, error) {
+	return ReadZipWithOptions(r, size, ReadOptions{})
+}
+
+// ReadZipWithOptions reads a GTFS zip. Files are parsed concurrently,
+// after agency.txt whose time zone the calendar files depend on.
+func ReadZipWithOptions(r io.ReaderAt, size int64, opts ReadOptions) (*Static, error) {
 	zr, err := zip.NewReader(r, size)
 	if err != nil {
 		return nil, err
 	}
 
+	workers := opts.StopTimeWorkers
+	if workers == 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+
 	out := &Static{}
 
 	if err := readFile(zr, out, "agency.txt", agencyHandler); err != nil {
 		return nil, err
 	}
 
-	if err := readFile(zr, out, "stops.txt", stopHandler); err != nil {
-		return nil, err
+	// each handler appends to its own field of out
+	files := []func() error{
+		func() error { return readFile(zr, out, "stops.txt", stopHandler) },
+		func() error { return readFile(zr, out, "routes.txt", routeHandler) },
+		func() error { return readFile(zr, out, "trips.txt", tripHandler) },
+		func() error { return readStopTimesFile(zr, out, workers) },
+		func() error { return readFile(zr, out, "calendar.txt", calendarHandler) },
+		func() error { return readFile(zr, out, "calendar_dates.txt", calendarDateHandler) },
+		func() error { return readFile(zr, out, "shapes.txt", shapeHandler) },
+		func() error { return readOptionalFile(zr, out, "transfers.txt", transferHandler) },
 	}
 
-	if err := readFile(zr, out, "routes.txt", routeHandler); err != nil {
-		return nil, err
+	errs := make([]error, len(files))
+	var wg sync.WaitGroup
+	for i, f := range files {
+		wg.Add(1)
+		go func(i int, f func() error) {
+			defer wg.Done()
+			errs[i] = f()
+		}(i, f)
 	}
+	wg.Wait()
 
-	if err := readFile(zr, out, "trips.txt", tripHandler); err != nil {
-		return nil, err
-	}
-
-	if err := readFile(zr, out, "stop_times.txt", stopTimeHandler); err != nil {
-		return nil, err
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
 	}
 
-	if err := readFile(zr, out, "calendar.txt", calendarHandler); err != nil {
-		return nil, err
+	if opts.StopTimeRows {
+		out.StopTimes = out.StopTimeTable.All()
 	}
 
-	if err := readFile(zr, out, "calendar_dates.txt", calendarDateHandler); err != nil {
-		return nil, err
-	}
+	return out, nil
+}
 
-	if err := readFile(zr, out, "shapes.txt", shapeHandler); err != nil {
-		return nil, err
-	}
+type fileHandler func(out *Static, rm record) error
 
-	return out, nil
+// record is a row of a GTFS file with fields looked up by header name.
+type record struct {
+	header map[string]int
+	fields []string
 }
 
-type fileHandler func(out *Static, rm map[string]string) error
+// get returns the value of the named field, or the empty string if the
+// file has no such column.
+func (r record) get(name string) string {
+	if i, ok := r.header[name]; ok && i < len(r.fields) {
+		return r.fields[i]
+	}
+	return ""
+}
 
-func readFile(zr *zip.Reader, out *Static, fn string, h fileHandler) error {
+func openFile(zr *zip.Reader, fn string) (io.ReadCloser, error) {
 	zf := findFile(zr.File, fn)
 	if zf == nil {
-		return errors.New(fn + " not found in zip")
+		return nil, errors.New(fn + " not found in zip")
 	}
+	return zf.Open()
+}
 
-	f, err := zf.Open()
+func readFile(zr *zip.Reader, out *Static, fn string, h fileHandler) error {
+	f, err := openFile(zr, fn)
 	if err != nil {
 		return err
 	}
 
-	return read(f, out, h)
+	return read(f, fn, out, h)
 }
 
-func read(r io.ReadCloser, out *Static, h fileHandler) error {
-	defer r.Close()
+// readOptionalFile is like readFile but does nothing if fn is missing.
+func readOptionalFile(zr *zip.Reader, out *Static, fn string, h fileHandler) error {
+	if findFile(zr.File, fn) == nil {
+		return nil
+	}
+	return readFile(zr, out, fn, h)
+}
 
-	cr := csv.NewReader(r)
+// csvFile reads the rows of a GTFS file, tolerating the quirks of
+// real-world feeds: a UTF-8 byte order mark, header names with
+// surrounding whitespace or in upper case, and rows with missing or
+// empty trailing fields.
+type csvFile struct {
+	name   string
+	cr     *csv.Reader
+	header map[string]int
+	width  int
+}
+
+var utf8BOM = []byte("\ufeff")
+
+func newCSVFile(r io.Reader, name string) (*csvFile, error) {
+	br := bufio.NewReader(r)
+	if b, err := br.Peek(len(utf8BOM)); err == nil && bytes.Equal(b, utf8BOM) {
+		br.Discard(len(utf8BOM))
+	}
+
+	cr := csv.NewReader(br)
+	cr.FieldsPerRecord = -1
 
 	hr, err := cr.Read()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+
+	header := make(map[string]int, len(hr))
+	for i, hf := range hr {
+		header[strings.ToLower(strings.TrimSpace(hf))] = i
+	}
+
+	return &csvFile{name: name, cr: cr, header: header, width: len(hr)}, nil
+}
+
+// next returns the next row and the line it starts on, or io.EOF.
+func (f *csvFile) next() ([]string, int, error) {
+	rec, err := f.cr.Read()
+	if err == io.EOF {
+		return nil, 0, err
+	}
+	if err != nil {
+		// csv.ParseError includes the line
+		return nil, 0, fmt.Errorf("%s: %w", f.name, err)
+	}
+
+	line, _ := f.cr.FieldPos(0)
+	for _, extra := range rec[min(len(rec), f.width):] {
+		if extra != "" {
+			return nil, line, f.lineError(line, fmt.Errorf("%d fields but header has %d", len(rec), f.width))
+		}
+	}
+	return rec, line, nil
+}
+
+func (f *csvFile) lineError(line int, err error) error {
+	return fmt.Errorf("%s:%d: %w", f.name, line, err)
+}
+
+func read(r io.ReadCloser, fn string, out *Static, h fileHandler) error {
+	defer r.Close()
+
+	f, err := newCSVFile(r, fn)
 	if err != nil {
 		return err
 	}
+	f.cr.ReuseRecord = true
+	rm := record{header: f.header}
 
 	for {
-		rec, err := cr.Read()
+		rec, line, err := f.next()
 		if err == io.EOF {
 			break
 		}
@@ -105,16 +225,127 @@ func read(r io.ReadCloser, out *Static, h fileHandler) error {
 			return err
 		}
 
-		rm := make(map[string]string)
-		for i, hf := range hr {
-			rm[hf] = rec[i]
+		rm.fields = rec
+		if err := h(out, rm); err != nil {
+			return f.lineError(line, err)
 		}
+	}
 
-		if err := h(out, rm); err != nil {
-			return err
+	return nil
+}
+
+// stopTimeChunkSize is the number of stop_times.txt rows handed to a
+// worker at a time.
+const stopTimeChunkSize = 8192
+
+type stopTimeChunk struct {
+	rows  [][]string
+	lines []int
+	out   Static
+	err   error
+
+	// readErr is the error reading the row after rows, which ends the
+	// file. It becomes err if no row in the chunk fails first.
+	readErr error
+}
+
+// readStopTimesFile reads stop_times.txt, splitting rows across workers
+// and appending their results to out in file order.
+func readStopTimesFile(zr *zip.Reader, out *Static, workers int) error {
+	const fn = "stop_times.txt"
+
+	r, err := openFile(zr, fn)
+	if err != nil {
+		return err
+	}
+	if workers < 2 {
+		return read(r, fn, out, stopTimeHandler)
+	}
+	defer r.Close()
+
+	f, err := newCSVFile(r, fn)
+	if err != nil {
+		return err
+	}
+
+	work := make(chan *stopTimeChunk)
+	stop := make(chan struct{})
+	var stopOnce sync.Once
+
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for c := range work {
+				rm := record{header: f.header}
+				for j, rec := range c.rows {
+					rm.fields = rec
+					if err := stopTimeHandler(&c.out, rm); err != nil {
+						c.err = f.lineError(c.lines[j], err)
+						break
+					}
+				}
+				if c.err == nil {
+					c.err = c.readErr
+				}
+				if c.err != nil {
+					stopOnce.Do(func() { close(stop) })
+				}
+				c.rows, c.lines = nil, nil
+			}
+		}()
+	}
+
+	var chunks []*stopTimeChunk
+	func() {
+		defer close(work)
+
+		for {
+			c := &stopTimeChunk{
+				rows:  make([][]string, 0, stopTimeChunkSize),
+				lines: make([]int, 0, stopTimeChunkSize),
+			}
+			for len(c.rows) < stopTimeChunkSize {
+				rec, line, err := f.next()
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					// rows before the bad one may still fail first
+					c.readErr = err
+					break
+				}
+				c.rows = append(c.rows, rec)
+				c.lines = append(c.lines, line)
+			}
+			if len(c.rows) == 0 && c.readErr == nil {
+				return
+			}
+
+			chunks = append(chunks, c)
+			select {
+			case work <- c:
+			case <-stop:
+				return
+			}
+			if c.readErr != nil {
+				return
+			}
+		}
+	}()
+	wg.Wait()
+
+	// chunks are in file order, and each chunk's error is its first
+	for _, c := range chunks {
+		if c.err != nil {
+			return c.err
 		}
 	}
 
+	for _, c := range chunks {
+		out.StopTimeTable.AppendAll(&c.out.StopTimeTable)
+	}
 	return nil
 }
 
@@ -127,17 +358,17 @@ func findFile(file []*zip.File, fn string) *zip.File {
 	return nil
 }
 
-func agencyHandler(out *Static, rm map[string]string) error {
+func agencyHandler(out *Static, rm record) error {
 	var a Agency
-	a.ID = rm["agency_id"]
-	a.Name = rm["agency_name"]
-	a.URL = rm["agency_url"]
-	a.Lang = rm["agency_lang"]
-	a.Phone = rm["agency_phone"]
-	a.FareURL = rm["agency_fare_url"]
-	a.Email = rm["agency_email"]
-
-	loc, err := time.LoadLocation(rm["agency_timezone"])
+	a.ID = rm.get("agency_id")
+	a.Name = rm.get("agency_name")
+	a.URL = rm.get("agency_url")
+	a.Lang = rm.get("agency_lang")
+	a.Phone = rm.get("agency_phone")
+	a.FareURL = rm.get("agency_fare_url")
+	a.Email = rm.get("agency_email")
+
+	loc, err := time.LoadLocation(rm.get("agency_timezone"))
 	if err != nil {
 		return err
 	}
@@ -155,140 +386,130 @@ func agencyHandler(out *Static, rm map[string]string) error {
 	return nil
 }
 
-func stopHandler(out *Static, rm map[string]string) error {
+func stopHandler(out *Static, rm record) error {
 	var s Stop
-	s.ID = rm["stop_id"]
-	s.Code = rm["stop_code"]
-	s.Name = rm["stop_name"]
-	s.Desc = rm["stop_desc"]
-	s.ZoneID = rm["zone_id"]
-	s.URL = rm["stop_url"]
-	s.ParentStation = rm["parent_station"]
-	s.Timezone = rm["stop_timezone"]
-
-	pt, err := parsePoint(rm["stop_lat"], rm["stop_lon"])
+	s.ID = rm.get("stop_id")
+	s.Code = rm.get("stop_code")
+	s.Name = rm.get("stop_name")
+	s.Desc = rm.get("stop_desc")
+	s.ZoneID = rm.get("zone_id")
+	s.URL = rm.get("stop_url")
+	s.ParentStation = rm.get("parent_station")
+	s.Timezone = rm.get("stop_timezone")
+
+	pt, err := parsePoint(rm.get("stop_lat"), rm.get("stop_lon"))
 	if err != nil {
 		return err
 	}
 	s.Point = pt
 
-	lt, err := strconv.Atoi(rm["location_type"])
+	lt, err := parseEnum(locationTypeNames, "location_type", rm.get("location_type"), LocationTypeStop)
 	if err != nil {
 		return err
 	}
 	s.LocationType = lt
 
-	if _, ok := rm["wheelchair_boarding"]; ok {
-		wb, err := strconv.Atoi(rm["wheelchair_boarding"])
-		if err != nil {
-			return err
-		}
-		s.WheelchairBoarding = wb
+	wb, err := parseEnum(wheelchairBoardingNames, "wheelchair_boarding", rm.get("wheelchair_boarding"), WheelchairBoardingUnknown)
+	if err != nil {
+		return err
 	}
+	s.WheelchairBoarding = wb
 
 	out.Stops = append(out.Stops, s)
 	return nil
 }
 
-func routeHandler(out *Static, rm map[string]string) error {
+func routeHandler(out *Static, rm record) error {
 	var r Route
-	r.ID = rm["route_id"]
-	r.AgencyID = rm["agency_id"]
-	r.ShortName = rm["route_short_name"]
-	r.LongName = rm["route_long_name"]
-	r.Desc = rm["route_desc"]
-	r.URL = rm["route_url"]
-	r.Color = rm["route_color"]
-	r.TextColor = rm["text_color"]
-
-	rt, err := strconv.Atoi(rm["route_type"])
+	r.ID = rm.get("route_id")
+	r.AgencyID = rm.get("agency_id")
+	r.ShortName = rm.get("route_short_name")
+	r.LongName = rm.get("route_long_name")
+	r.Desc = rm.get("route_desc")
+	r.URL = rm.get("route_url")
+	r.Color = rm.get("route_color")
+	r.TextColor = rm.get("route_text_color")
+
+	rt, err := strconv.Atoi(rm.get("route_type"))
 	if err != nil {
 		return err
 	}
-	r.Type = rt
+	r.Type = RouteType(rt)
 
 	out.Routes = append(out.Routes, r)
 	return nil
 }
 
-func tripHandler(out *Static, rm map[string]string) error {
+func tripHandler(out *Static, rm record) error {
 	var t Trip
-	t.ID = rm["trip_id"]
-	t.RouteID = rm["route_id"]
-	t.ServiceID = rm["service_id"]
-	t.Headsign = rm["trip_headsign"]
-	t.ShortName = rm["trip_short_name"]
-	t.BlockID = rm["block_id"]
-	t.ShapeID = rm["shape_id"]
-
-	di, err := strconv.Atoi(rm["direction_id"])
+	t.ID = rm.get("trip_id")
+	t.RouteID = rm.get("route_id")
+	t.ServiceID = rm.get("service_id")
+	t.Headsign = rm.get("trip_headsign")
+	t.ShortName = rm.get("trip_short_name")
+	t.BlockID = rm.get("block_id")
+	t.ShapeID = rm.get("shape_id")
+
+	di, err := strconv.Atoi(rm.get("direction_id"))
 	if err != nil {
 		return err
 	}
 	t.DirectionID = di
 
-	if was := rm["wheelchair_accessible"]; was != "" {
-		wai, err := strconv.Atoi(was)
-		if err != nil {
-			return err
-		}
-		t.WheelchairAccessible = wai
+	wa, err := parseEnum(wheelchairAccessibleNames, "wheelchair_accessible", rm.get("wheelchair_accessible"), WheelchairAccessibleUnknown)
+	if err != nil {
+		return err
 	}
+	t.WheelchairAccessible = wa
 
-	if bas := rm["bikes_allowed"]; bas != "" {
-		bai, err := strconv.Atoi(bas)
-		if err != nil {
-			return err
-		}
-		t.BikesAllowed = bai
+	ba, err := parseEnum(bikesAllowedNames, "bikes_allowed", rm.get("bikes_allowed"), BikesAllowedUnknown)
+	if err != nil {
+		return err
 	}
+	t.BikesAllowed = ba
 
 	out.Trips = append(out.Trips, t)
 	return nil
 }
 
-func stopTimeHandler(out *Static, rm map[string]string) error {
+func stopTimeHandler(out *Static, rm record) error {
 	var s StopTime
-	s.TripID = rm["trip_id"]
+	s.TripID = rm.get("trip_id")
 
-	at, err := parseTimeAsDuration(rm["arrival_time"])
+	at, err := parseTimeAsDuration(rm.get("arrival_time"))
 	if err != nil {
 		return err
 	}
 	s.ArrivalTime = at
 
-	dt, err := parseTimeAsDuration(rm["departure_time"])
+	dt, err := parseTimeAsDuration(rm.get("departure_time"))
 	if err != nil {
 		return err
 	}
 	s.DepartureTime = dt
 
-	s.StopID = rm["stop_id"]
-	s.StopHeadsign = rm["stop_headsign"]
+	s.StopID = rm.get("stop_id")
+	s.StopHeadsign = rm.get("stop_headsign")
 
-	ssi, err := strconv.Atoi(rm["stop_sequence"])
+	ssi, err := strconv.Atoi(rm.get("stop_sequence"))
 	if err != nil {
 		return err
 	}
 	s.StopSequence = ssi
 
-	if pts := rm["pickup_type"]; pts != "" {
-		pti, err := strconv.Atoi(pts)
-		if err != nil {
-			return err
-		}
-		s.PickupType = pti
+	pt, err := parseEnum(pickupDropOffTypeNames, "pickup_type", rm.get("pickup_type"), PickupDropOffRegular)
+	if err != nil {
+		return err
 	}
+	s.PickupType = pt
 
-	if dts := rm["drop_off_type"]; dts != "" {
-		dti, err := strconv.Atoi(dts)
-		if err != nil {
-			return err
-		}
-		s.DropOffType = dti
+	dot, err := parseEnum(pickupDropOffTypeNames, "drop_off_type", rm.get("drop_off_type"), PickupDropOffRegular)
+	if err != nil {
+		return err
 	}
+	s.DropOffType = dot
 
-	if sds := rm["shape_dist_traveled"]; sds != "" {
+	if sds := rm.get("shape_dist_traveled"); sds != "" {
 		sdf, err := strconv.ParseFloat(sds, 64)
 		if err != nil {
 			return err
@@ -298,18 +519,14 @@ func stopTimeHandler(out *Static, rm map[string]string) error {
 		s.ShapeDistTraveled = NoShapeDistTraveled
 	}
 
-	ts := rm["timepoint"]
-	if ts == "" {
-		// empty: Times are considered exact, which is the same as 1
-		ts = "1"
-	}
-	ti, err := strconv.Atoi(ts)
+	// empty: Times are considered exact, which is the same as 1
+	tp, err := parseEnum(timepointNames, "timepoint", rm.get("timepoint"), TimepointExact)
 	if err != nil {
 		return err
 	}
-	s.Timepoint = ti
+	s.Timepoint = tp
 
-	out.StopTimes = append(out.StopTimes, s)
+	out.StopTimeTable.Append(s)
 	return nil
 }
 
@@ -323,76 +540,83 @@ var numsToDays = map[int]string{
 	6: "sunday",
 }
 
-func calendarHandler(out *Static, rm map[string]string) error {
+func calendarHandler(out *Static, rm record) error {
 	if len(out.Agencies) == 0 {
 		return errors.New("no agencies for calendar data")
 	}
 	tz := out.Agencies[0].Timezone
 
 	var c Calendar
-	c.ServiceID = rm["service_id"]
+	c.ServiceID = rm.get("service_id")
 
-	sd, err := parseDateAtNoonInLocation(rm["start_date"], tz)
+	sd, err := parseDateAtNoonInLocation(rm.get("start_date"), tz)
 	if err != nil {
 		return err
 	}
 	c.StartDate = sd
 
-	ed, err := parseDateAtNoonInLocation(rm["end_date"], tz)
+	ed, err := parseDateAtNoonInLocation(rm.get("end_date"), tz)
 	if err != nil {
 		return err
 	}
 	c.EndDate = ed
 
 	for i, p := range []*bool{&c.Monday, &c.Tuesday, &c.Wednesday, &c.Thursday, &c.Friday, &c.Saturday, &c.Sunday} {
-		*p = rm[numsToDays[i]] == "1"
+		*p = rm.get(numsToDays[i]) == "1"
 	}
 
 	out.Calendar = append(out.Calendar, c)
 	return nil
 }
 
-func calendarDateHandler(out *Static, rm map[string]string) error {
+func calendarDateHandler(out *Static, rm record) error {
 	if len(out.Agencies) == 0 {
 		return errors.New("no agencies for calendar data")
 	}
 	tz := out.Agencies[0].Timezone
 
 	var c CalendarDate
-	c.ServiceID = rm["service_id"]
+	c.ServiceID = rm.get("service_id")
 
-	d, err := parseDateAtNoonInLocation(rm["date"], tz)
+	d, err := parseDateAtNoonInLocation(rm.get("date"), tz)
 	if err != nil {
 		return err
 	}
 	c.Date = d
 
-	c.ExceptionType = rm["exception_type"]
+	et, err := parseEnum(exceptionTypeNames, "exception_type", rm.get("exception_type"), ExceptionType(0))
+	if err != nil {
+		return err
+	}
+	if et == 0 {
+		return errors.New("exception_type: missing value")
+	}
+	c.ExceptionType = et
 
 	out.CalendarDates = append(out.CalendarDates, c)
 	return nil
 }
 
-func shapeHandler(out *Static, rm map[string]string) error {
+func shapeHandler(out *Static, rm record) error {
 	var s Shape
-	s.ID = rm["shape_id"]
+	s.ID = rm.get("shape_id")
 
 	s.Point = NoPoint
-	if rm["shape_pt_lat"] != "" && rm["shape_pt_lon"] != "" {
-		pt, err := parsePoint(rm["shape_pt_lat"], rm["shape_pt_lon"])
+	if rm.get("shape_pt_lat") != "" && rm.get("shape_pt_lon") != "" {
+		pt, err := parsePoint(rm.get("shape_pt_lat"), rm.get("shape_pt_lon"))
 		if err != nil {
 			return err
 		}
 		s.Point = pt
 	}
 
-	si, err := strconv.Atoi(rm["shape_pt_sequence"])
+	si, err := strconv.Atoi(rm.get("shape_pt_sequence"))
 	if err != nil {
 		return err
 	}
 	s.PtSequence = si
 
-	if sds := rm["shape_dist_traveled"]; sds != "" {
+	if sds := rm.get("shape_dist_traveled"); sds != "" {
 		sdf, err := strconv.ParseFloat(sds, 64)
 		if err != nil {
 			return err
@@ -406,6 +630,33 @@ func shapeHandler(out *Static, rm map[string]string) error {
 	return nil
 }
 
+func transferHandler(out *Static, rm record) error {
+	var t Transfer
+	t.FromStopID = rm.get("from_stop_id")
+	t.ToStopID = rm.get("to_stop_id")
+	t.FromRouteID = rm.get("from_route_id")
+	t.ToRouteID = rm.get("to_route_id")
+	t.FromTripID = rm.get("from_trip_id")
+	t.ToTripID = rm.get("to_trip_id")
+
+	tt, err := parseEnum(transferTypeNames, "transfer_type", rm.get("transfer_type"), TransferRecommended)
+	if err != nil {
+		return err
+	}
+	t.Type = tt
+
+	if mts := rm.get("min_transfer_time"); mts != "" {
+		mt, err := strconv.Atoi(mts)
+		if err != nil {
+			return fmt.Errorf("min_transfer_time: %w", err)
+		}
+		t.MinTransferTime = time.Duration(mt) * time.Second
+	}
+
+	out.Transfers = append(out.Transfers, t)
+	return nil
+}
+
 func parsePoint(lat, lon string) (Point, error) {
 	var p Point
 
@@ -430,6 +681,27 @@ func parseDateAtNoonInLocation(ds string, loc *time.Location) (time.Time, error)
 	return d.Add(-(12 * time.Hour)), nil
 }
 
+// ParseClock parses a time of day in H:MM or H:MM:SS form into a
+// duration since noon minus 12h, as used for stop times. Hours may
+// exceed 23.
+func ParseClock(ts string) (time.Duration, error) {
+	parts := strings.Split(ts, ":")
+	if len(parts) != 2 && len(parts) != 3 {
+		return 0, fmt.Errorf("time %q not in h:mm or h:mm:ss format", ts)
+	}
+
+	units := [...]time.Duration{time.Hour, time.Minute, time.Second}
+	var d time.Duration
+	for i, p := range parts {
+		n, err := strconv.Atoi(p)
+		if err != nil {
+			return 0, err
+		}
+		d += time.Duration(n) * units[i]
+	}
+	return d, nil
+}
+
 func parseTimeAsDuration(ts string) (time.Duration, error) {
 	parts := strings.Split(ts, ":")
 	if len(parts) != 3 {
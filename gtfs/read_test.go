@@ -0,0 +1,290 @@
+package gtfs
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// benchFeed returns a synthetic zip with trips trips of stopsPerTrip
+// stops each, drawn from stops stops.
+func benchFeed(tb testing.TB, stops, trips, stopsPerTrip int) []byte {
+	tb.Helper()
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	file := func(name string, write func(w *bytes.Buffer)) {
+		var b bytes.Buffer
+		write(&b)
+		w, err := zw.Create(name)
+		if err != nil {
+			tb.Fatal(err)
+		}
+		if _, err := w.Write(b.Bytes()); err != nil {
+			tb.Fatal(err)
+		}
+	}
+
+	file("agency.txt", func(w *bytes.Buffer) {
+		w.WriteString("agency_id,agency_name,agency_url,agency_timezone\n")
+		w.WriteString("a,Agency,https://example.com,America/Halifax\n")
+	})
+	file("stops.txt", func(w *bytes.Buffer) {
+		w.WriteString("stop_id,stop_name,stop_lat,stop_lon\n")
+		for i := 0; i < stops; i++ {
+			fmt.Fprintf(w, "S%d,Stop number %d,44.%04d,-63.%04d\n", i, i, i%10000, i/10%10000)
+		}
+	})
+	file("routes.txt", func(w *bytes.Buffer) {
+		w.WriteString("route_id,agency_id,route_short_name,route_long_name,route_type\n")
+		for i := 0; i < 100; i++ {
+			fmt.Fprintf(w, "R%d,a,%d,Route %d,3\n", i, i, i)
+		}
+	})
+	file("trips.txt", func(w *bytes.Buffer) {
+		w.WriteString("route_id,service_id,trip_id,direction_id\n")
+		for i := 0; i < trips; i++ {
+			fmt.Fprintf(w, "R%d,WK,T%d,%d\n", i%100, i, i%2)
+		}
+	})
+	file("stop_times.txt", func(w *bytes.Buffer) {
+		w.WriteString("trip_id,arrival_time,departure_time,stop_id,stop_sequence\n")
+		for i := 0; i < trips; i++ {
+			start := 5*3600 + i%1000*60
+			for j := 0; j < stopsPerTrip; j++ {
+				t := start + j*90
+				ts := fmt.Sprintf("%02d:%02d:%02d", t/3600, t/60%60, t%60)
+				fmt.Fprintf(w, "T%d,%s,%s,S%d,%d\n", i, ts, ts, (i*7+j)%stops, j+1)
+			}
+		}
+	})
+	file("calendar.txt", func(w *bytes.Buffer) {
+		w.WriteString("service_id,monday,tuesday,wednesday,thursday,friday,saturday,sunday,start_date,end_date\n")
+		w.WriteString("WK,1,1,1,1,1,0,0,20260101,20261231\n")
+	})
+	file("calendar_dates.txt", func(w *bytes.Buffer) {
+		w.WriteString("service_id,date,exception_type\n")
+	})
+	file("shapes.txt", func(w *bytes.Buffer) {
+		w.WriteString("shape_id,shape_pt_lat,shape_pt_lon,shape_pt_sequence\n")
+	})
+
+	if err := zw.Close(); err != nil {
+		tb.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// BenchmarkReadZip measures ReadZipWithOptions followed by FillMaps on a
+// feed with 400k stop times, reporting the heap retained by the result
+// as MB-retained.
+func BenchmarkReadZip(b *testing.B) {
+	zb := benchFeed(b, 3000, 10000, 40)
+
+	for _, bc := range []struct {
+		name string
+		opts ReadOptions
+	}{
+		{"default", ReadOptions{}},
+		{"rows", ReadOptions{StopTimeRows: true}},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			b.ReportAllocs()
+
+			var retained uint64
+			for i := 0; i < b.N; i++ {
+				var before, after runtime.MemStats
+				if i == 0 {
+					runtime.GC()
+					runtime.ReadMemStats(&before)
+				}
+
+				s, err := ReadZipWithOptions(bytes.NewReader(zb), int64(len(zb)), bc.opts)
+				if err != nil {
+					b.Fatal(err)
+				}
+				s.FillMaps()
+
+				if i == 0 {
+					b.StopTimer()
+					runtime.GC()
+					runtime.ReadMemStats(&after)
+					retained = after.HeapAlloc - before.HeapAlloc
+					runtime.KeepAlive(s)
+					b.StartTimer()
+				}
+			}
+			b.ReportMetric(float64(retained)/(1<<20), "MB-retained")
+		})
+	}
+}
+
+// minimalFeed holds the files of a small valid feed, keyed by name.
+var minimalFeed = map[string]string{
+	"agency.txt":         "agency_id,agency_name,agency_url,agency_timezone\na,Agency,https://example.com,America/Halifax\n",
+	"stops.txt":          "stop_id,stop_name,stop_lat,stop_lon\nA,Alpha,44.64,-63.57\nB,Bravo,44.65,-63.58\n",
+	"routes.txt":         "route_id,agency_id,route_short_name,route_long_name,route_type\n1,a,1,One,3\n",
+	"trips.txt":          "route_id,service_id,trip_id,direction_id\n1,WK,t1,0\n",
+	"stop_times.txt":     "trip_id,arrival_time,departure_time,stop_id,stop_sequence\nt1,08:00:00,08:00:00,A,1\nt1,08:05:00,08:05:00,B,2\n",
+	"calendar.txt":       "service_id,monday,tuesday,wednesday,thursday,friday,saturday,sunday,start_date,end_date\nWK,1,1,1,1,1,0,0,20260101,20261231\n",
+	"calendar_dates.txt": "service_id,date,exception_type\n",
+	"shapes.txt":         "shape_id,shape_pt_lat,shape_pt_lon,shape_pt_sequence\n",
+}
+
+// zipFeed returns a zip of minimalFeed with files replaced by those in
+// override.
+func zipFeed(tb testing.TB, override map[string]string) []byte {
+	tb.Helper()
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, content := range minimalFeed {
+		if o, ok := override[name]; ok {
+			content = o
+		}
+		w, err := zw.Create(name)
+		if err != nil {
+			tb.Fatal(err)
+		}
+		if _, err := w.Write([]byte(content)); err != nil {
+			tb.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		tb.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestReadStopTimesFirstError(t *testing.T) {
+	const (
+		badTime  = "t1,bad,08:00:00,A,1\n"
+		badQuote = "t1,\"08:00:00\"x,08:00:00,A,1\n"
+	)
+	timeErr := func(line int) string {
+		return fmt.Sprintf("stop_times.txt:%d: time \"bad\" not in h:m:s format", line)
+	}
+	quoteErr := func(line int) string {
+		return fmt.Sprintf("stop_times.txt: parse error on line %d, column 13: extraneous or missing \" in quoted-field", line)
+	}
+
+	for _, tc := range []struct {
+		name    string
+		bad     map[int]string // line number to row
+		wantErr string
+	}{
+		{"handler error chunks before read error", map[int]string{100: badTime, 20000: badQuote}, timeErr(100)},
+		{"handler error in read error's chunk", map[int]string{17000: badTime, 17500: badQuote}, timeErr(17000)},
+		{"read error only", map[int]string{17500: badQuote}, quoteErr(17500)},
+		{"handler error only", map[int]string{17000: badTime}, timeErr(17000)},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var sb strings.Builder
+			sb.WriteString("trip_id,arrival_time,departure_time,stop_id,stop_sequence\n")
+			for line := 2; line < 30000; line++ {
+				if row, ok := tc.bad[line]; ok {
+					sb.WriteString(row)
+					continue
+				}
+				sb.WriteString("t1,08:00:00,08:00:00,A,1\n")
+			}
+			zb := zipFeed(t, map[string]string{"stop_times.txt": sb.String()})
+
+			for _, workers := range []int{1, 4} {
+				_, err := ReadZipWithOptions(bytes.NewReader(zb), int64(len(zb)), ReadOptions{StopTimeWorkers: workers})
+				if err == nil || err.Error() != tc.wantErr {
+					t.Errorf("workers=%d: got error %v, want %q", workers, err, tc.wantErr)
+				}
+			}
+		})
+	}
+}
+
+func TestReadQuirks(t *testing.T) {
+	for _, tc := range []struct {
+		file    string
+		handler fileHandler
+		check   func(t *testing.T, s *Static)
+		wantErr string
+	}{
+		{
+			file:    "bom_agency.txt",
+			handler: agencyHandler,
+			check: func(t *testing.T, s *Static) {
+				if len(s.Agencies) != 1 || s.Agencies[0].ID != "a" || s.Agencies[0].Timezone.String() != "America/Halifax" {
+					t.Errorf("got agencies %+v", s.Agencies)
+				}
+			},
+		},
+		{
+			file:    "headers_stops.txt",
+			handler: stopHandler,
+			check: func(t *testing.T, s *Static) {
+				want := []Stop{{ID: "A", Name: "Alpha", Point: Point{44.64, -63.57}}}
+				if !reflect.DeepEqual(s.Stops, want) {
+					t.Errorf("got stops %+v, want %+v", s.Stops, want)
+				}
+			},
+		},
+		{
+			file:    "short_rows_stops.txt",
+			handler: stopHandler,
+			check: func(t *testing.T, s *Static) {
+				want := []Stop{
+					{ID: "A", Name: "Alpha", Point: Point{44.64, -63.57}},
+					{ID: "B", Name: "Bravo", Point: Point{44.65, -63.58}, Code: "2"},
+					{ID: "C", Name: "Charlie", Point: Point{44.66, -63.59}, Code: "3", WheelchairBoarding: WheelchairBoardingPossible},
+				}
+				if !reflect.DeepEqual(s.Stops, want) {
+					t.Errorf("got stops %+v, want %+v", s.Stops, want)
+				}
+			},
+		},
+		{
+			file:    "long_rows_stops.txt",
+			handler: stopHandler,
+			check: func(t *testing.T, s *Static) {
+				if len(s.Stops) != 2 || s.Stops[1].ID != "B" {
+					t.Errorf("got stops %+v", s.Stops)
+				}
+			},
+		},
+		{
+			file:    "long_row_error_stops.txt",
+			handler: stopHandler,
+			wantErr: "long_row_error_stops.txt:3: 5 fields but header has 4",
+		},
+		{
+			// the first row spans lines 2 and 3
+			file:    "line_error_stop_times.txt",
+			handler: stopTimeHandler,
+			wantErr: `line_error_stop_times.txt:5: time "8h10" not in h:m:s format`,
+		},
+	} {
+		t.Run(tc.file, func(t *testing.T) {
+			f, err := os.Open(filepath.Join("testdata", "quirks", tc.file))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var s Static
+			err = read(f, tc.file, &s, tc.handler)
+			if tc.wantErr != "" {
+				if err == nil || err.Error() != tc.wantErr {
+					t.Fatalf("got error %v, want %q", err, tc.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			tc.check(t, &s)
+		})
+	}
+}
@@ -0,0 +1,91 @@
+package router
+
+import (
+	"math"
+	"sort"
+	"time"
+
+	"github.com/danp/catchbus/gtfs"
+)
+
+// Footpaths returns walking transfers between stops of s that are at
+// most maxDist meters apart in a straight line, with MinTransferTime set
+// to the time needed to walk that distance at speed meters per second.
+// Only stops and boarding areas with a location are considered.
+//
+// The result is ordered by FromStopID and then ToStopID and has an entry
+// in each direction.
+func Footpaths(s *gtfs.Static, maxDist, speed float64) []gtfs.Transfer {
+	if maxDist <= 0 || speed <= 0 {
+		return nil
+	}
+
+	var stops []gtfs.Stop
+	maxLat := 0.0
+	for _, st := range s.Stops {
+		if st.Point == gtfs.NoPoint {
+			continue
+		}
+		if st.LocationType != gtfs.LocationTypeStop && st.LocationType != gtfs.LocationTypeBoardingArea {
+			continue
+		}
+		stops = append(stops, st)
+		maxLat = math.Max(maxLat, math.Abs(st.Point.Lat))
+	}
+
+	// bucket stops into cells at least maxDist on a side everywhere in
+	// the feed so only neighbouring cells need to be compared, using
+	// slightly less than the real meters per degree to be safe
+	const metersPerDegree = 110000.0
+	latCell := maxDist / metersPerDegree
+	lonCell := latCell / math.Max(math.Cos(maxLat*math.Pi/180), 0.01)
+
+	type cell struct{ lat, lon int }
+	cellOf := func(p gtfs.Point) cell {
+		return cell{int(math.Floor(p.Lat / latCell)), int(math.Floor(p.Lon / lonCell))}
+	}
+	cells := make(map[cell][]int)
+	for i, st := range stops {
+		c := cellOf(st.Point)
+		cells[c] = append(cells[c], i)
+	}
+
+	var out []gtfs.Transfer
+	for i, a := range stops {
+		c := cellOf(a.Point)
+		for dlat := -1; dlat <= 1; dlat++ {
+			for dlon := -1; dlon <= 1; dlon++ {
+				for _, j := range cells[cell{c.lat + dlat, c.lon + dlon}] {
+					if i == j {
+						continue
+					}
+					b := stops[j]
+					d := a.Point.DistanceTo(b.Point)
+					if d > maxDist {
+						continue
+					}
+					out = append(out, gtfs.Transfer{
+						FromStopID:      a.ID,
+						ToStopID:        b.ID,
+						Type:            gtfs.TransferMinTime,
+						MinTransferTime: walkTime(d, speed),
+					})
+				}
+			}
+		}
+	}
+
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].FromStopID != out[j].FromStopID {
+			return out[i].FromStopID < out[j].FromStopID
+		}
+		return out[i].ToStopID < out[j].ToStopID
+	})
+	return out
+}
+
+// walkTime returns the time to walk dist meters at speed meters per
+// second, rounded up to a whole second.
+func walkTime(dist, speed float64) time.Duration {
+	return time.Duration(math.Ceil(dist/speed)) * time.Second
+}
@@ -0,0 +1,94 @@
+package router
+
+import (
+	"sort"
+	"time"
+
+	"github.com/danp/catchbus/gtfs"
+	"github.com/danp/catchbus/gtfs/geojson"
+)
+
+// Reach is the earliest arrival at a stop from an origin.
+type Reach struct {
+	StopID string
+
+	// Arrival is the earliest arrival, as a duration since noon minus 12h
+	// on the service date, and Duration the time from the requested
+	// departure until then.
+	Arrival  time.Duration
+	Duration time.Duration
+
+	// Transfers is the number of changes between trips needed to arrive
+	// at Arrival, or -1 if the stop is reached without riding a trip.
+	Transfers int
+}
+
+// Reachable returns the stops that can be reached from the stop with ID
+// from, leaving no earlier than depart on service date d, within
+// maxDuration, ordered by arrival. The origin stops themselves are
+// included with a zero Duration. If from is a station, any of its stops
+// may be used. If r came from WithTripUpdates, d must be the date it was
+// updated for.
+func (r *Router) Reachable(from string, d time.Time, depart, maxDuration time.Duration) ([]Reach, error) {
+	origins, err := r.resolve(from)
+	if err != nil {
+		return nil, err
+	}
+
+	active, err := r.activeTrips(d)
+	if err != nil {
+		return nil, err
+	}
+	sr := r.newSearch(active)
+	sr.limit = secs(depart + maxDuration)
+	sr.run(origins, secs(depart), nil)
+
+	var out []Reach
+	for s, a := range sr.best {
+		if a == inf {
+			continue
+		}
+		// the earliest round reaching the best arrival has the fewest
+		// trips
+		k := 0
+		for sr.tau[k][s] != a {
+			k++
+		}
+		out = append(out, Reach{
+			StopID:    r.stopIDs[s],
+			Arrival:   dur(a),
+			Duration:  dur(a) - depart,
+			Transfers: k - 1,
+		})
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Arrival != out[j].Arrival {
+			return out[i].Arrival < out[j].Arrival
+		}
+		return out[i].StopID < out[j].StopID
+	})
+
+	return out, nil
+}
+
+// ReachFeatures returns the stops in reach as GeoJSON points, with
+// properties for the stop's ID and name, the arrival time, the minutes
+// taken to get there and the number of transfers. Stops without a
+// location are left out.
+func (r *Router) ReachFeatures(reach []Reach) *geojson.FeatureCollection {
+	var fs []geojson.Feature
+	for _, rc := range reach {
+		st, ok := r.s.StopIDsToStops[rc.StopID]
+		if !ok || st.Point == gtfs.NoPoint {
+			continue
+		}
+		fs = append(fs, geojson.NewFeature(st.ID, geojson.Point(st.Point), map[string]interface{}{
+			"stop_id":   st.ID,
+			"stop_name": st.Name,
+			"arrival":   gtfs.FormatTime(rc.Arrival),
+			"minutes":   rc.Duration.Minutes(),
+			"transfers": rc.Transfers,
+		}))
+	}
+	return geojson.NewFeatureCollection(fs)
+}
@@ -0,0 +1,210 @@
+package router
+
+import (
+	"slices"
+	"time"
+
+	"github.com/danp/catchbus/gtfs"
+	"github.com/danp/catchbus/gtfs/gtfsrt"
+)
+
+// WithTripUpdates returns a Router whose timetable for service date d
+// reflects the trip updates in m. It can only be queried for d; Route and
+// Reachable return an error for other dates. r is not modified.
+//
+// Updates for trips starting on other dates are ignored. Predicted
+// arrival and departure times and delays replace scheduled times, with
+// a delay carried on to following stops until the next prediction, as
+// the GTFS-realtime spec describes. Canceled and deleted trips are
+// removed, skipped stops can't be boarded or alighted at, and added and
+// replacement trips use the stops and times in their updates. Stops not
+// in the static feed are ignored.
+func (r *Router) WithTripUpdates(d time.Time, m *gtfsrt.FeedMessage) *Router {
+	nr := *r
+	nr.trips = slices.Clone(r.trips)
+	nr.updated = d
+
+	date := gtfs.FormatDate(d)
+	for _, e := range m.GetEntity() {
+		tu := e.GetTripUpdate()
+		if tu == nil || e.GetIsDeleted() {
+			continue
+		}
+		td := tu.GetTrip()
+		if sd := td.GetStartDate(); sd != "" && sd != date {
+			continue
+		}
+		i, ok := r.tripIdx[td.GetTripId()]
+
+		switch td.GetScheduleRelationship() {
+		case gtfsrt.TripDescriptor_SCHEDULED:
+			if ok {
+				nr.trips[i] = nr.updatedTrip(nr.trips[i], d, tu)
+			}
+		case gtfsrt.TripDescriptor_CANCELED, gtfsrt.TripDescriptor_DELETED:
+			if ok {
+				// trips with fewer than two stops are left out of patterns
+				nr.trips[i].stops = nil
+			}
+		case gtfsrt.TripDescriptor_ADDED:
+			t := nr.addedTrip(d, tu)
+			t.added = true
+			nr.trips = append(nr.trips, t)
+		case gtfsrt.TripDescriptor_REPLACEMENT:
+			if ok {
+				t := nr.addedTrip(d, tu)
+				t.routeID, t.serviceID = nr.trips[i].routeID, nr.trips[i].serviceID
+				nr.trips[i] = t
+			}
+		}
+	}
+
+	nr.buildPatterns()
+	return &nr
+}
+
+// updatedTrip returns a copy of t with the predictions in tu applied.
+func (r *Router) updatedTrip(t trip, d time.Time, tu *gtfsrt.TripUpdate) trip {
+	sched := t
+	t.arr = slices.Clone(t.arr)
+	t.dep = slices.Clone(t.dep)
+	t.board = slices.Clone(t.board)
+	t.alight = slices.Clone(t.alight)
+
+	stus := tu.GetStopTimeUpdate()
+	if len(stus) == 0 {
+		if tu.Delay != nil {
+			t.realtime = true
+			for i := range t.arr {
+				t.arr[i] += tu.GetDelay()
+				t.dep[i] += tu.GetDelay()
+			}
+		}
+		return t
+	}
+
+	// match updates to stops, which must be in order
+	updates := make([]*gtfsrt.TripUpdate_StopTimeUpdate, len(t.stops))
+	first, next := -1, 0
+	for _, stu := range stus {
+		pos := -1
+		for i := next; i < len(t.stops); i++ {
+			if stu.StopSequence != nil && t.seqs[i] == int32(stu.GetStopSequence()) ||
+				stu.StopSequence == nil && stu.GetStopId() != "" && r.stopIDs[t.stops[i]] == stu.GetStopId() {
+				pos = i
+				break
+			}
+		}
+		if pos < 0 {
+			continue
+		}
+		updates[pos] = stu
+		if first < 0 {
+			first = pos
+		}
+		next = pos + 1
+	}
+	if first < 0 {
+		return t
+	}
+	t.realtime = true
+
+	var delay int32
+	for i := first; i < len(t.stops); i++ {
+		arrDelay, depDelay := delay, delay
+		if stu := updates[i]; stu != nil {
+			switch stu.GetScheduleRelationship() {
+			case gtfsrt.TripUpdate_StopTimeUpdate_SKIPPED:
+				t.board[i], t.alight[i] = false, false
+			case gtfsrt.TripUpdate_StopTimeUpdate_NO_DATA:
+				delay, arrDelay, depDelay = 0, 0, 0
+			default:
+				a, aok := eventDelay(stu.GetArrival(), d, sched.arr[i])
+				dp, dok := eventDelay(stu.GetDeparture(), d, sched.dep[i])
+				switch {
+				case aok && dok:
+					arrDelay, depDelay = a, dp
+				case aok:
+					arrDelay, depDelay = a, a
+				case dok:
+					arrDelay, depDelay = dp, dp
+				}
+				delay = depDelay
+			}
+		}
+
+		t.arr[i] = sched.arr[i] + arrDelay
+		t.dep[i] = sched.dep[i] + depDelay
+		if i > 0 && t.arr[i] < t.dep[i-1] {
+			t.arr[i] = t.dep[i-1]
+		}
+		if t.dep[i] < t.arr[i] {
+			t.dep[i] = t.arr[i]
+		}
+	}
+
+	return t
+}
+
+// eventDelay returns the delay in seconds of ev relative to the
+// scheduled time sched.
+func eventDelay(ev *gtfsrt.TripUpdate_StopTimeEvent, d time.Time, sched int32) (int32, bool) {
+	switch {
+	case ev == nil:
+		return 0, false
+	case ev.Time != nil:
+		return rtSecs(d, ev.GetTime()) - sched, true
+	case ev.Delay != nil:
+		return ev.GetDelay(), true
+	}
+	return 0, false
+}
+
+// addedTrip returns a trip with the stops and times in tu.
+func (r *Router) addedTrip(d time.Time, tu *gtfsrt.TripUpdate) trip {
+	td := tu.GetTrip()
+	t := trip{id: td.GetTripId(), routeID: td.GetRouteId(), realtime: true}
+
+	for _, stu := range tu.GetStopTimeUpdate() {
+		if stu.GetScheduleRelationship() == gtfsrt.TripUpdate_StopTimeUpdate_SKIPPED {
+			continue
+		}
+		stop, ok := r.stopIdx[stu.GetStopId()]
+		if !ok {
+			continue
+		}
+
+		at, dt := stu.GetArrival().GetTime(), stu.GetDeparture().GetTime()
+		if at == 0 {
+			at = dt
+		}
+		if dt == 0 {
+			dt = at
+		}
+		if at == 0 {
+			continue
+		}
+		arr, dep := rtSecs(d, at), rtSecs(d, dt)
+		if n := len(t.stops); n > 0 && arr < t.dep[n-1] {
+			arr = t.dep[n-1]
+		}
+		if dep < arr {
+			dep = arr
+		}
+
+		t.stops = append(t.stops, stop)
+		t.seqs = append(t.seqs, int32(stu.GetStopSequence()))
+		t.arr = append(t.arr, arr)
+		t.dep = append(t.dep, dep)
+		t.board = append(t.board, true)
+		t.alight = append(t.alight, true)
+	}
+
+	return t
+}
+
+// rtSecs converts a GTFS-realtime POSIX time to seconds since noon
+// minus 12h on service date d.
+func rtSecs(d time.Time, unix int64) int32 {
+	return secs(time.Unix(unix, 0).Sub(d))
+}
@@ -0,0 +1,711 @@
+// Package router plans journeys over a GTFS static timetable using
+// RAPTOR (Delling, Pajor and Werneck, "Round-Based Public Transit
+// Routing").
+package router
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/danp/catchbus/gtfs"
+)
+
+// Defaults used when the corresponding Options field is zero.
+const (
+	DefaultMaxTransfers = 4
+	DefaultWalkSpeed    = 1.3 // meters per second
+	DefaultMaxWalk      = 400 // meters
+)
+
+// Options configures a Router.
+type Options struct {
+	// MaxTransfers is the most transfers between trips a journey may
+	// have. Zero allows only direct trips; most callers want
+	// DefaultMaxTransfers.
+	MaxTransfers int
+
+	// WalkSpeed is the walking speed in meters per second used for
+	// footpaths. Zero means DefaultWalkSpeed.
+	WalkSpeed float64
+
+	// MaxWalk is the longest straight-line distance in meters for which
+	// footpaths between stops are generated with Footpaths, in addition
+	// to those from transfers.txt. Zero means DefaultMaxWalk and a
+	// negative value disables generated footpaths.
+	MaxWalk float64
+
+	// MinTransferTime is the least time allowed to change between trips
+	// at the same stop, unless transfers.txt specifies a longer one.
+	MinTransferTime time.Duration
+}
+
+// Router answers journey planning queries over a gtfs.Static. It is
+// safe for concurrent use.
+type Router struct {
+	s    *gtfs.Static
+	opts Options
+
+	stopIDs  []string
+	stopIdx  map[string]int32
+	children map[int32][]int32
+
+	trips   []trip
+	tripIdx map[string]int32
+
+	patterns     []pattern
+	stopPatterns [][]patternStop
+
+	footpaths  [][]footpath
+	changeTime []int32 // seconds, per stop
+
+	// updated is the service date trip updates were applied for, if any
+	updated time.Time
+}
+
+// trip is the timetable of a trip, from the static feed or realtime
+// updates.
+type trip struct {
+	id, routeID, serviceID string
+
+	// added trips come from realtime updates and run on the date the
+	// Router was updated for, whatever their service ID
+	added bool
+
+	// realtime is set if any times come from realtime updates
+	realtime bool
+
+	stops         []int32
+	seqs          []int32
+	arr, dep      []int32 // seconds
+	board, alight []bool
+}
+
+// pattern is a sequence of stops served by trips that never overtake
+// each other, so that its trips are ordered by departure at every stop.
+type pattern struct {
+	stops []int32
+	trips []int32 // indexes into Router.trips
+
+	// per trip, per stop
+	arr, dep      []int32 // seconds
+	board, alight []bool
+}
+
+func (p *pattern) at(trip, pos int) int {
+	return trip*len(p.stops) + pos
+}
+
+type patternStop struct {
+	pattern, pos int32
+}
+
+type footpath struct {
+	to   int32
+	secs int32
+}
+
+// New returns a Router for s, which must not be modified afterwards.
+// FillMaps must have been called on s.
+func New(s *gtfs.Static, opts Options) *Router {
+	if opts.MaxTransfers < 0 {
+		opts.MaxTransfers = 0
+	}
+	if opts.WalkSpeed == 0 {
+		opts.WalkSpeed = DefaultWalkSpeed
+	}
+	if opts.MaxWalk == 0 {
+		opts.MaxWalk = DefaultMaxWalk
+	}
+
+	r := &Router{
+		s:        s,
+		opts:     opts,
+		stopIdx:  make(map[string]int32, len(s.Stops)),
+		children: make(map[int32][]int32),
+	}
+
+	for _, st := range s.Stops {
+		r.stop(st.ID)
+	}
+	for _, st := range s.Stops {
+		if st.ParentStation != "" {
+			p := r.stop(st.ParentStation)
+			r.children[p] = append(r.children[p], r.stop(st.ID))
+		}
+	}
+
+	r.buildTrips()
+	r.buildPatterns()
+	r.buildTransfers()
+
+	return r
+}
+
+// stop returns the index of the stop with the given ID, adding it if
+// needed.
+func (r *Router) stop(id string) int32 {
+	if i, ok := r.stopIdx[id]; ok {
+		return i
+	}
+	i := int32(len(r.stopIDs))
+	r.stopIDs = append(r.stopIDs, id)
+	r.stopIdx[id] = i
+	return i
+}
+
+func (r *Router) buildTrips() {
+	r.trips = make([]trip, 0, len(r.s.Trips))
+	r.tripIdx = make(map[string]int32, len(r.s.Trips))
+	for _, t := range r.s.Trips {
+		sts := r.s.StopTimesForTrip(t.ID)
+		tr := trip{
+			id:        t.ID,
+			routeID:   t.RouteID,
+			serviceID: t.ServiceID,
+			stops:     make([]int32, len(sts)),
+			seqs:      make([]int32, len(sts)),
+			arr:       make([]int32, len(sts)),
+			dep:       make([]int32, len(sts)),
+			board:     make([]bool, len(sts)),
+			alight:    make([]bool, len(sts)),
+		}
+		for i, st := range sts {
+			tr.stops[i] = r.stop(st.StopID)
+			tr.seqs[i] = int32(st.StopSequence)
+			tr.arr[i] = secs(st.ArrivalTime)
+			tr.dep[i] = secs(st.DepartureTime)
+			tr.board[i] = st.PickupType != gtfs.PickupDropOffNone
+			tr.alight[i] = st.DropOffType != gtfs.PickupDropOffNone
+		}
+		r.tripIdx[t.ID] = int32(len(r.trips))
+		r.trips = append(r.trips, tr)
+	}
+}
+
+func (r *Router) buildPatterns() {
+	byStops := make(map[string][]int32)
+	var order []string
+	for i, t := range r.trips {
+		if len(t.stops) < 2 {
+			continue
+		}
+		var key []byte
+		for _, st := range t.stops {
+			key = strconv.AppendInt(key, int64(st), 10)
+			key = append(key, ',')
+		}
+		k := string(key)
+		if _, ok := byStops[k]; !ok {
+			order = append(order, k)
+		}
+		byStops[k] = append(byStops[k], int32(i))
+	}
+
+	r.patterns = nil
+	for _, k := range order {
+		tis := byStops[k]
+		sort.SliceStable(tis, func(i, j int) bool { return r.trips[tis[i]].dep[0] < r.trips[tis[j]].dep[0] })
+
+		// split into patterns whose trips don't overtake each other
+		var ps []*pattern
+		for _, ti := range tis {
+			t := &r.trips[ti]
+			var p *pattern
+			for _, c := range ps {
+				if !overtakes(c, t) {
+					p = c
+					break
+				}
+			}
+			if p == nil {
+				p = &pattern{stops: t.stops}
+				ps = append(ps, p)
+			}
+			p.trips = append(p.trips, ti)
+			p.arr = append(p.arr, t.arr...)
+			p.dep = append(p.dep, t.dep...)
+			p.board = append(p.board, t.board...)
+			p.alight = append(p.alight, t.alight...)
+		}
+		for _, p := range ps {
+			r.patterns = append(r.patterns, *p)
+		}
+	}
+
+	r.stopPatterns = make([][]patternStop, len(r.stopIDs))
+	for pi, p := range r.patterns {
+		for pos, st := range p.stops {
+			r.stopPatterns[st] = append(r.stopPatterns[st], patternStop{int32(pi), int32(pos)})
+		}
+	}
+}
+
+// overtakes reports whether t, departing its first stop no earlier than
+// the last trip of p, arrives at or departs from any stop before it.
+func overtakes(p *pattern, t *trip) bool {
+	last := len(p.trips) - 1
+	for i := range t.stops {
+		j := p.at(last, i)
+		if t.arr[i] < p.arr[j] || t.dep[i] < p.dep[j] {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *Router) buildTransfers() {
+	r.footpaths = make([][]footpath, len(r.stopIDs))
+	r.changeTime = make([]int32, len(r.stopIDs))
+	for i := range r.changeTime {
+		r.changeTime[i] = secs(r.opts.MinTransferTime)
+	}
+
+	type pair struct{ from, to int32 }
+	seen := make(map[pair]bool)
+	add := func(from, to int32, secs int32) {
+		if seen[pair{from, to}] {
+			return
+		}
+		seen[pair{from, to}] = true
+		r.footpaths[from] = append(r.footpaths[from], footpath{to, secs})
+	}
+
+	for _, t := range r.s.Transfers {
+		if t.FromRouteID != "" || t.ToRouteID != "" || t.FromTripID != "" || t.ToTripID != "" {
+			// only stop to stop transfers are supported
+			continue
+		}
+		from, fok := r.stopIdx[t.FromStopID]
+		to, tok := r.stopIdx[t.ToStopID]
+		if !fok || !tok {
+			continue
+		}
+
+		if from == to {
+			if t.Type == gtfs.TransferMinTime && secs(t.MinTransferTime) > r.changeTime[from] {
+				r.changeTime[from] = secs(t.MinTransferTime)
+			}
+			continue
+		}
+
+		switch t.Type {
+		case gtfs.TransferNotPossible:
+			// keep generated footpaths from adding it
+			seen[pair{from, to}] = true
+		case gtfs.TransferMinTime:
+			add(from, to, secs(t.MinTransferTime))
+		default:
+			a, b := r.s.StopIDsToStops[t.FromStopID], r.s.StopIDsToStops[t.ToStopID]
+			var d float64
+			if a != nil && b != nil && a.Point != gtfs.NoPoint && b.Point != gtfs.NoPoint {
+				d = a.Point.DistanceTo(b.Point)
+			}
+			add(from, to, secs(walkTime(d, r.opts.WalkSpeed)))
+		}
+	}
+
+	if r.opts.MaxWalk > 0 {
+		for _, t := range Footpaths(r.s, r.opts.MaxWalk, r.opts.WalkSpeed) {
+			add(r.stopIdx[t.FromStopID], r.stopIdx[t.ToStopID], secs(t.MinTransferTime))
+		}
+	}
+}
+
+// Journey is a way to travel from an origin to a destination. Times are
+// durations since noon minus 12h on the service date, as in
+// gtfs.StopTime.
+type Journey struct {
+	Legs []Leg
+}
+
+// Departure returns the time the journey leaves its origin.
+func (j Journey) Departure() time.Duration {
+	return j.Legs[0].Departure
+}
+
+// Arrival returns the time the journey reaches its destination.
+func (j Journey) Arrival() time.Duration {
+	return j.Legs[len(j.Legs)-1].Arrival
+}
+
+// Transfers returns the number of changes between trips.
+func (j Journey) Transfers() int {
+	var n int
+	for _, l := range j.Legs {
+		if !l.Walking() {
+			n++
+		}
+	}
+	if n == 0 {
+		return 0
+	}
+	return n - 1
+}
+
+// Leg is part of a Journey spent on one trip or walking between stops.
+type Leg struct {
+	// TripID and RouteID are empty for walking legs.
+	TripID  string
+	RouteID string
+
+	FromStopID string
+	ToStopID   string
+	Departure  time.Duration
+	Arrival    time.Duration
+
+	// Realtime is set if the trip's times come from realtime updates
+	// rather than the schedule. See Router.WithTripUpdates.
+	Realtime bool
+}
+
+// Walking reports whether l is a walk between stops.
+func (l Leg) Walking() bool {
+	return l.TripID == ""
+}
+
+// Route returns the Pareto-optimal journeys from the stop with ID from to
+// the stop with ID to, leaving no earlier than depart on service date d:
+// for each number of transfers, the journey arriving earliest, if it
+// arrives earlier than all journeys with fewer transfers. Journeys are
+// ordered by increasing transfers and so decreasing arrival time.
+//
+// If from or to is a station, any of its stops may be used. Only trips
+// of service date d are considered. If r came from WithTripUpdates, d
+// must be the date it was updated for.
+func (r *Router) Route(from, to string, d time.Time, depart time.Duration) ([]Journey, error) {
+	origins, err := r.resolve(from)
+	if err != nil {
+		return nil, err
+	}
+	targets, err := r.resolve(to)
+	if err != nil {
+		return nil, err
+	}
+
+	active, err := r.activeTrips(d)
+	if err != nil {
+		return nil, err
+	}
+	sr := r.newSearch(active)
+	sr.run(origins, secs(depart), targets)
+
+	var out []Journey
+	bestArr := int32(inf)
+	for k := range sr.tau {
+		arr, target := int32(inf), int32(-1)
+		for _, t := range targets {
+			if sr.tau[k][t] < arr {
+				arr, target = sr.tau[k][t], t
+			}
+		}
+		if arr >= bestArr || sr.labels[k][target].kind == labelOrigin {
+			continue
+		}
+		bestArr = arr
+		out = append(out, sr.journey(k, target))
+	}
+	return out, nil
+}
+
+// resolve returns the stops for the stop or station with the given ID.
+func (r *Router) resolve(id string) ([]int32, error) {
+	i, ok := r.stopIdx[id]
+	if !ok {
+		return nil, fmt.Errorf("stop %q not found", id)
+	}
+	return append([]int32{i}, r.children[i]...), nil
+}
+
+// activeTrips returns which of r.trips run on service date d.
+func (r *Router) activeTrips(d time.Time) ([]bool, error) {
+	if !r.updated.IsZero() && !d.Equal(r.updated) {
+		return nil, fmt.Errorf("router has trip updates for %s, not %s", gtfs.FormatDate(r.updated), gtfs.FormatDate(d))
+	}
+	services := r.s.ActiveServicesForDate(d)
+	out := make([]bool, len(r.trips))
+	for i, t := range r.trips {
+		out[i] = t.added || services[t.serviceID]
+	}
+	return out, nil
+}
+
+const inf = math.MaxInt32
+
+type labelKind uint8
+
+const (
+	labelNone labelKind = iota
+	labelOrigin
+	labelTransit
+	labelWalk
+)
+
+// label records how a stop was reached in a round.
+type label struct {
+	kind labelKind
+
+	// transit: the pattern, trip within it and positions boarded and
+	// alighted at
+	pattern, trip, boardPos, alightPos int32
+
+	// walk: the stop walked from
+	from int32
+}
+
+// search holds the state of one RAPTOR run.
+type search struct {
+	r      *Router
+	active []bool
+
+	tau    [][]int32 // per round, per stop arrival, inf if not improved
+	labels [][]label
+	best   []int32 // earliest arrival per stop over all rounds
+
+	// arrivals after limit are pruned
+	limit int32
+
+	marked   []bool
+	markList []int32
+
+	// stops walked from in the current relaxFootpaths
+	source []bool
+}
+
+func (r *Router) newSearch(active []bool) *search {
+	rounds := r.opts.MaxTransfers + 2 // walking only plus one per trip
+	sr := &search{
+		r:      r,
+		active: active,
+		tau:    make([][]int32, rounds),
+		labels: make([][]label, rounds),
+		best:   make([]int32, len(r.stopIDs)),
+		limit:  inf,
+		marked: make([]bool, len(r.stopIDs)),
+		source: make([]bool, len(r.stopIDs)),
+	}
+	for k := range sr.tau {
+		sr.tau[k] = make([]int32, len(r.stopIDs))
+		for i := range sr.tau[k] {
+			sr.tau[k][i] = inf
+		}
+		sr.labels[k] = make([]label, len(r.stopIDs))
+	}
+	for i := range sr.best {
+		sr.best[i] = inf
+	}
+	return sr
+}
+
+func (sr *search) mark(stop int32) {
+	if !sr.marked[stop] {
+		sr.marked[stop] = true
+		sr.markList = append(sr.markList, stop)
+	}
+}
+
+// takeMarked returns and clears the marked stops.
+func (sr *search) takeMarked() []int32 {
+	ms := sr.markList
+	for _, s := range ms {
+		sr.marked[s] = false
+	}
+	sr.markList = nil
+	return ms
+}
+
+// bound returns the earliest arrival at any of targets so far, or
+// limit if earlier. Arrivals not before it are pruned.
+func (sr *search) bound(targets []int32) int32 {
+	b := sr.limit
+	if b < inf {
+		b++
+	}
+	for _, t := range targets {
+		if sr.best[t] < b {
+			b = sr.best[t]
+		}
+	}
+	return b
+}
+
+// run performs rounds of RAPTOR from origins at depart. If targets is
+// empty, earliest arrivals are computed at all stops.
+func (sr *search) run(origins []int32, depart int32, targets []int32) {
+	for _, o := range origins {
+		sr.tau[0][o] = depart
+		sr.best[o] = depart
+		sr.labels[0][o] = label{kind: labelOrigin}
+		sr.mark(o)
+	}
+	sr.relaxFootpaths(0, sr.takeMarked(), targets)
+
+	for k := 1; k < len(sr.tau); k++ {
+		marked := sr.takeMarked()
+		if len(marked) == 0 {
+			break
+		}
+		sr.scanPatterns(k, marked, targets)
+		sr.relaxFootpaths(k, sr.takeMarked(), targets)
+	}
+}
+
+// scanPatterns runs round k over the patterns serving stops marked in
+// the previous round, marking stops it improves.
+func (sr *search) scanPatterns(k int, marked []int32, targets []int32) {
+	r := sr.r
+
+	// earliest marked position in each pattern
+	first := make(map[int32]int32)
+	var pis []int32
+	for _, s := range marked {
+		for _, ps := range r.stopPatterns[s] {
+			pos, ok := first[ps.pattern]
+			if !ok {
+				pis = append(pis, ps.pattern)
+			}
+			if !ok || ps.pos < pos {
+				first[ps.pattern] = ps.pos
+			}
+		}
+	}
+	// scan in a fixed order so ties are broken the same way every time
+	sort.Slice(pis, func(i, j int) bool { return pis[i] < pis[j] })
+
+	prevTau, prevLabels := sr.tau[k-1], sr.labels[k-1]
+	for _, pi := range pis {
+		p := &r.patterns[pi]
+		start := first[pi]
+		trip, boardPos := -1, int32(-1)
+
+		for pos := int(start); pos < len(p.stops); pos++ {
+			s := p.stops[pos]
+
+			if trip >= 0 && p.alight[p.at(trip, pos)] {
+				a := p.arr[p.at(trip, pos)]
+				if a < sr.best[s] && a < sr.bound(targets) {
+					sr.tau[k][s] = a
+					sr.best[s] = a
+					sr.labels[k][s] = label{kind: labelTransit, pattern: pi, trip: int32(trip), boardPos: boardPos, alightPos: int32(pos)}
+					sr.mark(s)
+				}
+			}
+
+			prev := prevTau[s]
+			if prev == inf {
+				continue
+			}
+			if prevLabels[s].kind == labelTransit {
+				prev += r.changeTime[s]
+			}
+			if trip >= 0 && prev > p.dep[p.at(trip, pos)] {
+				continue
+			}
+			if t := sr.earliestTrip(p, pos, prev); t >= 0 && (trip < 0 || t < trip) {
+				trip, boardPos = t, int32(pos)
+			}
+		}
+	}
+}
+
+// earliestTrip returns the first active trip of p that can be boarded at
+// pos at or after t, or -1.
+func (sr *search) earliestTrip(p *pattern, pos int, t int32) int {
+	n := len(p.trips)
+	i := sort.Search(n, func(i int) bool { return p.dep[p.at(i, pos)] >= t })
+	for ; i < n; i++ {
+		if sr.active[p.trips[i]] && p.board[p.at(i, pos)] {
+			return i
+		}
+	}
+	return -1
+}
+
+// relaxFootpaths walks from the stops reached by transit, or the
+// origins, in round k, marking the stops it improves along with marked.
+// Walks only start from those stops and never replace their labels, so
+// no journey walks twice in a row and every walk leaves at the arrival
+// its source was reached with.
+func (sr *search) relaxFootpaths(k int, marked []int32, targets []int32) {
+	var sources []int32
+	for _, s := range marked {
+		sr.mark(s)
+		if kind := sr.labels[k][s].kind; kind == labelTransit || kind == labelOrigin {
+			sources = append(sources, s)
+			sr.source[s] = true
+		}
+	}
+	defer func() {
+		for _, s := range sources {
+			sr.source[s] = false
+		}
+	}()
+
+	for _, s := range sources {
+		for _, fp := range sr.r.footpaths[s] {
+			if sr.source[fp.to] {
+				continue
+			}
+			a := sr.tau[k][s] + fp.secs
+			if a < sr.best[fp.to] && a < sr.bound(targets) {
+				sr.tau[k][fp.to] = a
+				sr.best[fp.to] = a
+				sr.labels[k][fp.to] = label{kind: labelWalk, from: s}
+				sr.mark(fp.to)
+			}
+		}
+	}
+}
+
+// journey reconstructs the journey reaching stop in round k.
+func (sr *search) journey(k int, stop int32) Journey {
+	r := sr.r
+
+	var legs []Leg
+	for {
+		l := sr.labels[k][stop]
+		switch l.kind {
+		case labelWalk:
+			legs = append(legs, Leg{
+				FromStopID: r.stopIDs[l.from],
+				ToStopID:   r.stopIDs[stop],
+				Departure:  dur(sr.tau[k][l.from]),
+				Arrival:    dur(sr.tau[k][stop]),
+			})
+			stop = l.from
+			continue
+		case labelTransit:
+			p := &r.patterns[l.pattern]
+			t := &r.trips[p.trips[l.trip]]
+			board := p.stops[l.boardPos]
+			legs = append(legs, Leg{
+				TripID:     t.id,
+				RouteID:    t.routeID,
+				Realtime:   t.realtime,
+				FromStopID: r.stopIDs[board],
+				ToStopID:   r.stopIDs[stop],
+				Departure:  dur(p.dep[p.at(int(l.trip), int(l.boardPos))]),
+				Arrival:    dur(p.arr[p.at(int(l.trip), int(l.alightPos))]),
+			})
+			stop = board
+			k--
+			continue
+		}
+		break
+	}
+
+	for i, j := 0, len(legs)-1; i < j; i, j = i+1, j-1 {
+		legs[i], legs[j] = legs[j], legs[i]
+	}
+	return Journey{Legs: legs}
+}
+
+func secs(d time.Duration) int32 {
+	return int32(d / time.Second)
+}
+
+func dur(s int32) time.Duration {
+	return time.Duration(s) * time.Second
+}
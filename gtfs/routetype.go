@@ -0,0 +1,244 @@
+package gtfs
+
+import "strconv"
+
+// RouteType is a route_type value from routes.txt.
+//
+// Values below 100 are the basic types from the GTFS reference.
+// Values from 100 up are the extended types documented at
+// https://developers.google.com/transit/gtfs/reference/extended-route-types.
+type RouteType int
+
+// Basic route types.
+const (
+	RouteTypeTram       RouteType = 0
+	RouteTypeSubway     RouteType = 1
+	RouteTypeRail       RouteType = 2
+	RouteTypeBus        RouteType = 3
+	RouteTypeFerry      RouteType = 4
+	RouteTypeCableTram  RouteType = 5
+	RouteTypeAerialLift RouteType = 6
+	RouteTypeFunicular  RouteType = 7
+	RouteTypeTrolleybus RouteType = 11
+	RouteTypeMonorail   RouteType = 12
+)
+
+// Extended route types.
+const (
+	RouteTypeRailwayService          RouteType = 100
+	RouteTypeHighSpeedRail           RouteType = 101
+	RouteTypeLongDistanceTrains      RouteType = 102
+	RouteTypeInterRegionalRail       RouteType = 103
+	RouteTypeCarTransportRail        RouteType = 104
+	RouteTypeSleeperRail             RouteType = 105
+	RouteTypeRegionalRail            RouteType = 106
+	RouteTypeTouristRailway          RouteType = 107
+	RouteTypeRailShuttle             RouteType = 108
+	RouteTypeSuburbanRailway         RouteType = 109
+	RouteTypeReplacementRail         RouteType = 110
+	RouteTypeSpecialRail             RouteType = 111
+	RouteTypeLorryTransportRail      RouteType = 112
+	RouteTypeAllRailServices         RouteType = 113
+	RouteTypeCrossCountryRail        RouteType = 114
+	RouteTypeVehicleTransportRail    RouteType = 115
+	RouteTypeRackAndPinionRailway    RouteType = 116
+	RouteTypeAdditionalRailService   RouteType = 117
+	RouteTypeCoachService            RouteType = 200
+	RouteTypeInternationalCoach      RouteType = 201
+	RouteTypeNationalCoach           RouteType = 202
+	RouteTypeShuttleCoach            RouteType = 203
+	RouteTypeRegionalCoach           RouteType = 204
+	RouteTypeSpecialCoach            RouteType = 205
+	RouteTypeSightseeingCoach        RouteType = 206
+	RouteTypeTouristCoach            RouteType = 207
+	RouteTypeCommuterCoach           RouteType = 208
+	RouteTypeAllCoachServices        RouteType = 209
+	RouteTypeUrbanRailwayService     RouteType = 400
+	RouteTypeMetro                   RouteType = 401
+	RouteTypeUnderground             RouteType = 402
+	RouteTypeUrbanRailway            RouteType = 403
+	RouteTypeAllUrbanRailwayServices RouteType = 404
+	RouteTypeMonorailService         RouteType = 405
+	RouteTypeBusService              RouteType = 700
+	RouteTypeRegionalBus             RouteType = 701
+	RouteTypeExpressBus              RouteType = 702
+	RouteTypeStoppingBus             RouteType = 703
+	RouteTypeLocalBus                RouteType = 704
+	RouteTypeNightBus                RouteType = 705
+	RouteTypePostBus                 RouteType = 706
+	RouteTypeSpecialNeedsBus         RouteType = 707
+	RouteTypeMobilityBus             RouteType = 708
+	RouteTypeMobilityBusDisabled     RouteType = 709
+	RouteTypeSightseeingBus          RouteType = 710
+	RouteTypeShuttleBus              RouteType = 711
+	RouteTypeSchoolBus               RouteType = 712
+	RouteTypeSchoolAndPublicBus      RouteType = 713
+	RouteTypeRailReplacementBus      RouteType = 714
+	RouteTypeDemandAndResponseBus    RouteType = 715
+	RouteTypeAllBusServices          RouteType = 716
+	RouteTypeTrolleybusService       RouteType = 800
+	RouteTypeTramService             RouteType = 900
+	RouteTypeCityTram                RouteType = 901
+	RouteTypeLocalTram               RouteType = 902
+	RouteTypeRegionalTram            RouteType = 903
+	RouteTypeSightseeingTram         RouteType = 904
+	RouteTypeShuttleTram             RouteType = 905
+	RouteTypeAllTramServices         RouteType = 906
+	RouteTypeWaterTransportService   RouteType = 1000
+	RouteTypeAirService              RouteType = 1100
+	RouteTypeFerryService            RouteType = 1200
+	RouteTypeAerialLiftService       RouteType = 1300
+	RouteTypeTelecabin               RouteType = 1301
+	RouteTypeCableCar                RouteType = 1302
+	RouteTypeElevator                RouteType = 1303
+	RouteTypeChairLift               RouteType = 1304
+	RouteTypeDragLift                RouteType = 1305
+	RouteTypeSmallTelecabin          RouteType = 1306
+	RouteTypeAllTelecabinServices    RouteType = 1307
+	RouteTypeFunicularService        RouteType = 1400
+	RouteTypeTaxiService             RouteType = 1500
+	RouteTypeCommunalTaxi            RouteType = 1501
+	RouteTypeWaterTaxi               RouteType = 1502
+	RouteTypeRailTaxi                RouteType = 1503
+	RouteTypeBikeTaxi                RouteType = 1504
+	RouteTypeLicensedTaxi            RouteType = 1505
+	RouteTypePrivateHireVehicle      RouteType = 1506
+	RouteTypeAllTaxiServices         RouteType = 1507
+	RouteTypeMiscellaneousService    RouteType = 1700
+	RouteTypeHorseDrawnCarriage      RouteType = 1702
+)
+
+type routeTypeInfo struct {
+	name  string
+	basic RouteType
+}
+
+// noBasic marks extended types with no equivalent basic type.
+const noBasic = RouteType(-1)
+
+var routeTypes = map[RouteType]routeTypeInfo{
+	RouteTypeTram:       {"Tram", RouteTypeTram},
+	RouteTypeSubway:     {"Subway", RouteTypeSubway},
+	RouteTypeRail:       {"Rail", RouteTypeRail},
+	RouteTypeBus:        {"Bus", RouteTypeBus},
+	RouteTypeFerry:      {"Ferry", RouteTypeFerry},
+	RouteTypeCableTram:  {"Cable Tram", RouteTypeCableTram},
+	RouteTypeAerialLift: {"Aerial Lift", RouteTypeAerialLift},
+	RouteTypeFunicular:  {"Funicular", RouteTypeFunicular},
+	RouteTypeTrolleybus: {"Trolleybus", RouteTypeTrolleybus},
+	RouteTypeMonorail:   {"Monorail", RouteTypeMonorail},
+
+	RouteTypeRailwayService:          {"Railway Service", RouteTypeRail},
+	RouteTypeHighSpeedRail:           {"High Speed Rail Service", RouteTypeRail},
+	RouteTypeLongDistanceTrains:      {"Long Distance Trains", RouteTypeRail},
+	RouteTypeInterRegionalRail:       {"Inter Regional Rail Service", RouteTypeRail},
+	RouteTypeCarTransportRail:        {"Car Transport Rail Service", RouteTypeRail},
+	RouteTypeSleeperRail:             {"Sleeper Rail Service", RouteTypeRail},
+	RouteTypeRegionalRail:            {"Regional Rail Service", RouteTypeRail},
+	RouteTypeTouristRailway:          {"Tourist Railway Service", RouteTypeRail},
+	RouteTypeRailShuttle:             {"Rail Shuttle (Within Complex)", RouteTypeRail},
+	RouteTypeSuburbanRailway:         {"Suburban Railway", RouteTypeRail},
+	RouteTypeReplacementRail:         {"Replacement Rail Service", RouteTypeRail},
+	RouteTypeSpecialRail:             {"Special Rail Service", RouteTypeRail},
+	RouteTypeLorryTransportRail:      {"Lorry Transport Rail Service", RouteTypeRail},
+	RouteTypeAllRailServices:         {"All Rail Services", RouteTypeRail},
+	RouteTypeCrossCountryRail:        {"Cross-Country Rail Service", RouteTypeRail},
+	RouteTypeVehicleTransportRail:    {"Vehicle Transport Rail Service", RouteTypeRail},
+	RouteTypeRackAndPinionRailway:    {"Rack and Pinion Railway", RouteTypeRail},
+	RouteTypeAdditionalRailService:   {"Additional Rail Service", RouteTypeRail},
+	RouteTypeCoachService:            {"Coach Service", RouteTypeBus},
+	RouteTypeInternationalCoach:      {"International Coach Service", RouteTypeBus},
+	RouteTypeNationalCoach:           {"National Coach Service", RouteTypeBus},
+	RouteTypeShuttleCoach:            {"Shuttle Coach Service", RouteTypeBus},
+	RouteTypeRegionalCoach:           {"Regional Coach Service", RouteTypeBus},
+	RouteTypeSpecialCoach:            {"Special Coach Service", RouteTypeBus},
+	RouteTypeSightseeingCoach:        {"Sightseeing Coach Service", RouteTypeBus},
+	RouteTypeTouristCoach:            {"Tourist Coach Service", RouteTypeBus},
+	RouteTypeCommuterCoach:           {"Commuter Coach Service", RouteTypeBus},
+	RouteTypeAllCoachServices:        {"All Coach Services", RouteTypeBus},
+	RouteTypeUrbanRailwayService:     {"Urban Railway Service", RouteTypeSubway},
+	RouteTypeMetro:                   {"Metro Service", RouteTypeSubway},
+	RouteTypeUnderground:             {"Underground Service", RouteTypeSubway},
+	RouteTypeUrbanRailway:            {"Urban Railway Service", RouteTypeSubway},
+	RouteTypeAllUrbanRailwayServices: {"All Urban Railway Services", RouteTypeSubway},
+	RouteTypeMonorailService:         {"Monorail", RouteTypeMonorail},
+	RouteTypeBusService:              {"Bus Service", RouteTypeBus},
+	RouteTypeRegionalBus:             {"Regional Bus Service", RouteTypeBus},
+	RouteTypeExpressBus:              {"Express Bus Service", RouteTypeBus},
+	RouteTypeStoppingBus:             {"Stopping Bus Service", RouteTypeBus},
+	RouteTypeLocalBus:                {"Local Bus Service", RouteTypeBus},
+	RouteTypeNightBus:                {"Night Bus Service", RouteTypeBus},
+	RouteTypePostBus:                 {"Post Bus Service", RouteTypeBus},
+	RouteTypeSpecialNeedsBus:         {"Special Needs Bus", RouteTypeBus},
+	RouteTypeMobilityBus:             {"Mobility Bus Service", RouteTypeBus},
+	RouteTypeMobilityBusDisabled:     {"Mobility Bus for Registered Disabled", RouteTypeBus},
+	RouteTypeSightseeingBus:          {"Sightseeing Bus", RouteTypeBus},
+	RouteTypeShuttleBus:              {"Shuttle Bus", RouteTypeBus},
+	RouteTypeSchoolBus:               {"School Bus", RouteTypeBus},
+	RouteTypeSchoolAndPublicBus:      {"School and Public Service Bus", RouteTypeBus},
+	RouteTypeRailReplacementBus:      {"Rail Replacement Bus Service", RouteTypeBus},
+	RouteTypeDemandAndResponseBus:    {"Demand and Response Bus Service", RouteTypeBus},
+	RouteTypeAllBusServices:          {"All Bus Services", RouteTypeBus},
+	RouteTypeTrolleybusService:       {"Trolleybus Service", RouteTypeTrolleybus},
+	RouteTypeTramService:             {"Tram Service", RouteTypeTram},
+	RouteTypeCityTram:                {"City Tram Service", RouteTypeTram},
+	RouteTypeLocalTram:               {"Local Tram Service", RouteTypeTram},
+	RouteTypeRegionalTram:            {"Regional Tram Service", RouteTypeTram},
+	RouteTypeSightseeingTram:         {"Sightseeing Tram Service", RouteTypeTram},
+	RouteTypeShuttleTram:             {"Shuttle Tram Service", RouteTypeTram},
+	RouteTypeAllTramServices:         {"All Tram Services", RouteTypeTram},
+	RouteTypeWaterTransportService:   {"Water Transport Service", RouteTypeFerry},
+	RouteTypeAirService:              {"Air Service", noBasic},
+	RouteTypeFerryService:            {"Ferry Service", RouteTypeFerry},
+	RouteTypeAerialLiftService:       {"Aerial Lift Service", RouteTypeAerialLift},
+	RouteTypeTelecabin:               {"Telecabin Service", RouteTypeAerialLift},
+	RouteTypeCableCar:                {"Cable Car Service", RouteTypeAerialLift},
+	RouteTypeElevator:                {"Elevator Service", noBasic},
+	RouteTypeChairLift:               {"Chair Lift Service", RouteTypeAerialLift},
+	RouteTypeDragLift:                {"Drag Lift Service", RouteTypeAerialLift},
+	RouteTypeSmallTelecabin:          {"Small Telecabin Service", RouteTypeAerialLift},
+	RouteTypeAllTelecabinServices:    {"All Telecabin Services", RouteTypeAerialLift},
+	RouteTypeFunicularService:        {"Funicular Service", RouteTypeFunicular},
+	RouteTypeTaxiService:             {"Taxi Service", noBasic},
+	RouteTypeCommunalTaxi:            {"Communal Taxi Service", RouteTypeBus},
+	RouteTypeWaterTaxi:               {"Water Taxi Service", RouteTypeFerry},
+	RouteTypeRailTaxi:                {"Rail Taxi Service", noBasic},
+	RouteTypeBikeTaxi:                {"Bike Taxi Service", noBasic},
+	RouteTypeLicensedTaxi:            {"Licensed Taxi Service", noBasic},
+	RouteTypePrivateHireVehicle:      {"Private Hire Service Vehicle", noBasic},
+	RouteTypeAllTaxiServices:         {"All Taxi Services", noBasic},
+	RouteTypeMiscellaneousService:    {"Miscellaneous Service", noBasic},
+	RouteTypeHorseDrawnCarriage:      {"Horse-drawn Carriage", noBasic},
+}
+
+// Valid reports whether t is a known basic or extended route type.
+func (t RouteType) Valid() bool {
+	_, ok := routeTypes[t]
+	return ok
+}
+
+// Extended reports whether t is an extended route type.
+func (t RouteType) Extended() bool {
+	return t >= 100
+}
+
+// Basic returns the basic route type corresponding to t.
+// Basic types map to themselves. ok is false for unknown types and
+// for extended types, such as air service or taxis, with no basic
+// equivalent.
+func (t RouteType) Basic() (basic RouteType, ok bool) {
+	ti, ok := routeTypes[t]
+	if !ok || ti.basic == noBasic {
+		return t, false
+	}
+	return ti.basic, true
+}
+
+// String returns the human-readable name of t, such as "Bus" or
+// "Express Bus Service".
+func (t RouteType) String() string {
+	if ti, ok := routeTypes[t]; ok {
+		return ti.name
+	}
+	return "RouteType(" + strconv.Itoa(int(t)) + ")"
+}
@@ -0,0 +1,329 @@
+package gtfs
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Snapshots start with snapshotMagic, then snapshotVersion as a
+// big-endian uint32, then the checksum of the source the snapshot was
+// built from, then a gob-encoded snapshot.
+//
+// Stop times are stored indexed, ordered by trip and stop sequence and
+// with the rows of each stop ordered by departure, so FillMaps doesn't
+// need to sort them again. The other maps built by FillMaps hold
+// pointers into the rows and are quick to rebuild, so they aren't
+// stored and FillMaps must still be called on a Static read from a
+// snapshot.
+//
+// snapshotVersion must be incremented whenever snapshot or the types
+// it contains change.
+const (
+	snapshotMagic   = "GTFSSNAP"
+	snapshotVersion = 4
+)
+
+// ErrSnapshotStale is returned by ReadSnapshot when a snapshot was
+// written by a different version of this package.
+var ErrSnapshotStale = errors.New("snapshot version mismatch")
+
+type snapshot struct {
+	Agencies      []snapshotAgency
+	Stops         []Stop
+	Routes        []Route
+	Trips         []Trip
+	StopTimes     snapshotStopTimes
+	Calendar      []Calendar
+	CalendarDates []CalendarDate
+	Shapes        snapshotShapes
+	Transfers     []Transfer
+}
+
+type snapshotAgency struct {
+	ID       string
+	Name     string
+	URL      string
+	Timezone string
+	Lang     string
+	Phone    string
+	FareURL  string
+	Email    string
+}
+
+// snapshotStopTimes mirrors the columns of StopTimes.
+type snapshotStopTimes struct {
+	Strings []string
+
+	TripID            []int32
+	ArrivalTime       []int32
+	DepartureTime     []int32
+	StopID            []int32
+	StopSequence      []int32
+	StopHeadsign      []int32
+	PickupType        []uint8
+	DropOffType       []uint8
+	ShapeDistTraveled []float64
+	Timepoint         []uint8
+
+	// StopRows is the stop index, rows grouped by stop and ordered by
+	// departure.
+	StopRows []int32
+}
+
+type snapshotShapes struct {
+	Strings []string
+
+	ID           []uint32
+	Lat          []float64
+	Lon          []float64
+	PtSequence   []int32
+	DistTraveled []float64
+}
+
+type interner struct {
+	strings []string
+	index   map[string]uint32
+}
+
+func (in *interner) intern(s string) uint32 {
+	if i, ok := in.index[s]; ok {
+		return i
+	}
+	if in.index == nil {
+		in.index = make(map[string]uint32)
+	}
+	i := uint32(len(in.strings))
+	in.strings = append(in.strings, s)
+	in.index[s] = i
+	return i
+}
+
+// WriteSnapshot writes s to w in a binary format that ReadSnapshot loads
+// much faster than ReadZip parses the original zip. sum identifies the
+// source s was read from, usually the SHA-256 of the zip. If FillMaps
+// hasn't been called, s.StopTimeTable is indexed as it would.
+func WriteSnapshot(w io.Writer, s *Static, sum [sha256.Size]byte) error {
+	bw := bufio.NewWriter(w)
+
+	var hdr bytes.Buffer
+	hdr.WriteString(snapshotMagic)
+	binary.Write(&hdr, binary.BigEndian, uint32(snapshotVersion))
+	hdr.Write(sum[:])
+	if _, err := bw.Write(hdr.Bytes()); err != nil {
+		return err
+	}
+
+	snap := snapshot{
+		Stops:         s.Stops,
+		Routes:        s.Routes,
+		Trips:         s.Trips,
+		Calendar:      s.Calendar,
+		CalendarDates: s.CalendarDates,
+		Transfers:     s.Transfers,
+	}
+
+	for _, a := range s.Agencies {
+		snap.Agencies = append(snap.Agencies, snapshotAgency{
+			ID:       a.ID,
+			Name:     a.Name,
+			URL:      a.URL,
+			Timezone: a.Timezone.String(),
+			Lang:     a.Lang,
+			Phone:    a.Phone,
+			FareURL:  a.FareURL,
+			Email:    a.Email,
+		})
+	}
+
+	st := &s.StopTimeTable
+	if !st.indexed() {
+		st.index()
+	}
+	snap.StopTimes = snapshotStopTimes{
+		Strings:           st.strs,
+		TripID:            st.trip,
+		ArrivalTime:       st.arrival,
+		DepartureTime:     st.departure,
+		StopID:            st.stop,
+		StopSequence:      st.sequence,
+		StopHeadsign:      st.headsign,
+		PickupType:        st.pickup,
+		DropOffType:       st.dropOff,
+		ShapeDistTraveled: st.shapeDist,
+		Timepoint:         st.timepoint,
+		StopRows:          st.stopRows(),
+	}
+
+	var in interner
+	ssh := &snap.Shapes
+	for _, sh := range s.Shapes {
+		ssh.ID = append(ssh.ID, in.intern(sh.ID))
+		ssh.Lat = append(ssh.Lat, sh.Point.Lat)
+		ssh.Lon = append(ssh.Lon, sh.Point.Lon)
+		ssh.PtSequence = append(ssh.PtSequence, int32(sh.PtSequence))
+		ssh.DistTraveled = append(ssh.DistTraveled, sh.DistTraveled)
+	}
+	ssh.Strings = in.strings
+
+	if err := gob.NewEncoder(bw).Encode(&snap); err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+// ReadSnapshot reads a snapshot written by WriteSnapshot, returning the
+// Static and the sum it was written with. If the snapshot was written
+// by a different version of this package, ErrSnapshotStale is returned.
+//
+// As with ReadZip, FillMaps is not called on the result and must be
+// called before using its maps or stop time accessors, though it reuses
+// the stored stop time indexes. Stop times are only restored to
+// StopTimeTable; the deprecated StopTimes is left nil.
+func ReadSnapshot(r io.Reader) (*Static, [sha256.Size]byte, error) {
+	var sum [sha256.Size]byte
+
+	br := bufio.NewReader(r)
+	hdr := make([]byte, len(snapshotMagic)+4+sha256.Size)
+	if _, err := io.ReadFull(br, hdr); err != nil {
+		return nil, sum, err
+	}
+	if string(hdr[:len(snapshotMagic)]) != snapshotMagic {
+		return nil, sum, errors.New("not a snapshot")
+	}
+	if v := binary.BigEndian.Uint32(hdr[len(snapshotMagic):]); v != snapshotVersion {
+		return nil, sum, fmt.Errorf("%w: got version %d, want %d", ErrSnapshotStale, v, snapshotVersion)
+	}
+	copy(sum[:], hdr[len(snapshotMagic)+4:])
+
+	var snap snapshot
+	if err := gob.NewDecoder(br).Decode(&snap); err != nil {
+		return nil, sum, err
+	}
+
+	out := &Static{
+		Stops:         snap.Stops,
+		Routes:        snap.Routes,
+		Trips:         snap.Trips,
+		Calendar:      snap.Calendar,
+		CalendarDates: snap.CalendarDates,
+		Transfers:     snap.Transfers,
+	}
+
+	for _, a := range snap.Agencies {
+		loc, err := time.LoadLocation(a.Timezone)
+		if err != nil {
+			return nil, sum, err
+		}
+		out.Agencies = append(out.Agencies, Agency{
+			ID:       a.ID,
+			Name:     a.Name,
+			URL:      a.URL,
+			Timezone: loc,
+			Lang:     a.Lang,
+			Phone:    a.Phone,
+			FareURL:  a.FareURL,
+			Email:    a.Email,
+		})
+	}
+
+	// gob keeps only the offset of times, restore the location
+	loc := out.Location()
+	for i := range out.Calendar {
+		out.Calendar[i].StartDate = out.Calendar[i].StartDate.In(loc)
+		out.Calendar[i].EndDate = out.Calendar[i].EndDate.In(loc)
+	}
+	for i := range out.CalendarDates {
+		out.CalendarDates[i].Date = out.CalendarDates[i].Date.In(loc)
+	}
+
+	sst := snap.StopTimes
+	out.StopTimeTable = StopTimes{
+		strs:      sst.Strings,
+		strIndex:  make(map[string]int32, len(sst.Strings)),
+		trip:      sst.TripID,
+		stop:      sst.StopID,
+		headsign:  sst.StopHeadsign,
+		arrival:   sst.ArrivalTime,
+		departure: sst.DepartureTime,
+		sequence:  sst.StopSequence,
+		pickup:    sst.PickupType,
+		dropOff:   sst.DropOffType,
+		timepoint: sst.Timepoint,
+		shapeDist: sst.ShapeDistTraveled,
+	}
+	for i, s := range sst.Strings {
+		out.StopTimeTable.strIndex[s] = int32(i)
+	}
+	out.StopTimeTable.indexFromStopRows(sst.StopRows)
+
+	ssh := snap.Shapes
+	out.Shapes = make([]Shape, len(ssh.ID))
+	for i := range out.Shapes {
+		out.Shapes[i] = Shape{
+			ID:           ssh.Strings[ssh.ID[i]],
+			Point:        Point{Lat: ssh.Lat[i], Lon: ssh.Lon[i]},
+			PtSequence:   int(ssh.PtSequence[i]),
+			DistTraveled: ssh.DistTraveled[i],
+		}
+	}
+
+	return out, sum, nil
+}
+
+// ReadZipFileCached is like ReadZipFile but keeps a snapshot of the
+// parsed feed at snapshotPath. The snapshot is used when it was built
+// from a zip with the same SHA-256 as the one at path by this version of
+// the package, and is rebuilt otherwise.
+//
+// FillMaps is not called on the result, as with ReadSnapshot. The
+// deprecated Static.StopTimes is left nil, as with ReadZip.
+func ReadZipFileCached(path, snapshotPath string) (*Static, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(b)
+
+	if f, err := os.Open(snapshotPath); err == nil {
+		s, ssum, err := ReadSnapshot(f)
+		f.Close()
+		if err == nil && ssum == sum {
+			return s, nil
+		}
+	}
+
+	s, err := ReadZip(bytes.NewReader(b), int64(len(b)))
+	if err != nil {
+		return nil, err
+	}
+
+	// write to a temporary file and rename so readers never see a
+	// partial snapshot
+	tmp, err := os.CreateTemp(filepath.Dir(snapshotPath), filepath.Base(snapshotPath)+".tmp*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := WriteSnapshot(tmp, s, sum); err != nil {
+		tmp.Close()
+		return nil, err
+	}
+	if err := tmp.Close(); err != nil {
+		return nil, err
+	}
+	if err := os.Rename(tmp.Name(), snapshotPath); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
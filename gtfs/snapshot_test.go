@@ -0,0 +1,75 @@
+package gtfs
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"reflect"
+	"testing"
+)
+
+func TestSnapshotRoundTrip(t *testing.T) {
+	zb := benchFeed(t, 50, 200, 10)
+	read := func() *Static {
+		s, err := ReadZip(bytes.NewReader(zb), int64(len(zb)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}
+
+	want := read()
+	want.FillMaps()
+
+	// written before FillMaps, as ReadZipFileCached does
+	var buf bytes.Buffer
+	sum := sha256.Sum256(zb)
+	if err := WriteSnapshot(&buf, read(), sum); err != nil {
+		t.Fatal(err)
+	}
+	got, gotSum, err := ReadSnapshot(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if gotSum != sum {
+		t.Errorf("got sum %x, want %x", gotSum, sum)
+	}
+	if !got.StopTimeTable.indexed() {
+		t.Error("stop times not indexed after ReadSnapshot")
+	}
+	got.FillMaps()
+
+	for _, tr := range want.Trips {
+		if g, w := got.StopTimesForTrip(tr.ID), want.StopTimesForTrip(tr.ID); !reflect.DeepEqual(g, w) {
+			t.Errorf("StopTimesForTrip(%q) = %+v, want %+v", tr.ID, g, w)
+		}
+	}
+	for _, st := range want.Stops {
+		if g, w := got.StopTimesForStop(st.ID), want.StopTimesForStop(st.ID); !reflect.DeepEqual(g, w) {
+			t.Errorf("StopTimesForStop(%q) = %+v, want %+v", st.ID, g, w)
+		}
+	}
+}
+
+// BenchmarkReadSnapshot measures ReadSnapshot followed by FillMaps on a
+// feed with 400k stop times.
+func BenchmarkReadSnapshot(b *testing.B) {
+	zb := benchFeed(b, 3000, 10000, 40)
+	s, err := ReadZip(bytes.NewReader(zb), int64(len(zb)))
+	if err != nil {
+		b.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := WriteSnapshot(&buf, s, sha256.Sum256(zb)); err != nil {
+		b.Fatal(err)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		s, _, err := ReadSnapshot(bytes.NewReader(buf.Bytes()))
+		if err != nil {
+			b.Fatal(err)
+		}
+		s.FillMaps()
+	}
+}
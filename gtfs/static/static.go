@@ -0,0 +1,277 @@
+// Package static keeps a GTFS static feed fetched over HTTP up to date.
+package static
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+
+	"github.com/danp/catchbus/gtfs"
+)
+
+// DefaultInterval is the default interval between checks for a new zip.
+// It is used when Feed.Interval is zero.
+const DefaultInterval = time.Hour
+
+// Cache file names within Feed.CacheDir.
+const (
+	zipFile      = "gtfs.zip"
+	snapshotFile = "gtfs.snap"
+	metaFile     = "gtfs.json"
+)
+
+// Feed periodically fetches a GTFS zip and holds the parsed result.
+//
+// Requests are conditional on the ETag and Last-Modified of the last
+// response, and the zip is only parsed again when its contents change.
+type Feed struct {
+	URL string
+
+	// CacheDir, if set, is a directory where the zip, a snapshot of the
+	// parsed feed and the validators of the last response are kept.
+	// The cache is loaded by Start, so a restarted process has data
+	// before its first fetch completes and skips refetching an
+	// unchanged zip.
+	CacheDir string
+
+	// Interval specifies how often to check for a new zip.
+	// An Interval of zero means the DefaultInterval will be used.
+	Interval time.Duration
+
+	static atomic.Value
+
+	// only used by the monitor goroutine
+	meta meta
+}
+
+// meta is what's needed to make conditional requests and detect
+// unchanged zips.
+type meta struct {
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"last_modified,omitempty"`
+	Sum          []byte `json:"sum,omitempty"`
+}
+
+func (f *Feed) Start() {
+	if f.Interval == 0 {
+		f.Interval = DefaultInterval
+	}
+
+	go f.monitor()
+}
+
+// Current returns the most recently loaded feed, with FillMaps already
+// called, or nil if none has been loaded yet. It must not be modified.
+func (f *Feed) Current() *gtfs.Static {
+	c := f.static.Load()
+	if c == nil {
+		return nil
+	}
+	return c.(*gtfs.Static)
+}
+
+func (f *Feed) monitor() {
+	if f.CacheDir != "" {
+		f.loadCache()
+	}
+
+	tick := time.NewTicker(f.Interval)
+	defer tick.Stop()
+
+	for {
+		f.fetch()
+		<-tick.C
+	}
+}
+
+func (f *Feed) loadCache() {
+	b, err := os.ReadFile(filepath.Join(f.CacheDir, metaFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return
+	}
+	if err != nil {
+		log.Printf("ns=static fn=loadCache at=err err=%q", err)
+		return
+	}
+	var m meta
+	if err := json.Unmarshal(b, &m); err != nil {
+		log.Printf("ns=static fn=loadCache at=err err=%q", err)
+		return
+	}
+
+	s, err := gtfs.ReadZipFileCached(filepath.Join(f.CacheDir, zipFile), filepath.Join(f.CacheDir, snapshotFile))
+	if err != nil {
+		log.Printf("ns=static fn=loadCache at=err err=%q", err)
+		return
+	}
+	s.FillMaps()
+
+	f.static.Store(s)
+	f.meta = m
+	log.Printf("ns=static fn=loadCache at=done trips=%d", len(s.Trips))
+}
+
+func (f *Feed) fetch() {
+	b, m, err := f.get()
+	if err != nil {
+		// logged by get
+		return
+	}
+	if b == nil {
+		// not modified
+		return
+	}
+
+	if bytes.Equal(m.Sum, f.meta.Sum) && f.Current() != nil {
+		log.Printf("ns=static fn=fetch url=%q at=unchanged", f.URL)
+		f.meta = m
+		f.saveMeta()
+		return
+	}
+
+	s, err := gtfs.ReadZip(bytes.NewReader(b), int64(len(b)))
+	if err != nil {
+		log.Printf("ns=static fn=fetch url=%q at=err err=%q", f.URL, err)
+		return
+	}
+	s.FillMaps()
+
+	f.static.Store(s)
+	f.meta = m
+	if err := f.cache(b, s, m); err != nil {
+		// the cache keeps its last good zip, with validators to match
+		log.Printf("ns=static fn=fetch url=%q at=cache-err err=%q", f.URL, err)
+	} else {
+		f.saveMeta()
+	}
+	log.Printf("ns=static fn=fetch url=%q at=done trips=%d", f.URL, len(s.Trips))
+}
+
+// cache replaces the cached zip and snapshot with b, which parsed as s,
+// with validators m. It is only called once b has parsed, so the cache
+// always holds the last good zip.
+func (f *Feed) cache(b []byte, s *gtfs.Static, m meta) error {
+	if f.CacheDir == "" {
+		return nil
+	}
+
+	var sum [sha256.Size]byte
+	copy(sum[:], m.Sum)
+	var snap bytes.Buffer
+	if err := gtfs.WriteSnapshot(&snap, s, sum); err != nil {
+		return err
+	}
+
+	// a zip and snapshot out of step are fine, ReadZipFileCached
+	// rebuilds the snapshot
+	if err := writeFile(filepath.Join(f.CacheDir, zipFile), b); err != nil {
+		return err
+	}
+	return writeFile(filepath.Join(f.CacheDir, snapshotFile), snap.Bytes())
+}
+
+func (f *Feed) saveMeta() {
+	if f.CacheDir == "" {
+		return
+	}
+
+	b, err := json.Marshal(f.meta)
+	if err == nil {
+		err = writeFile(filepath.Join(f.CacheDir, metaFile), b)
+	}
+	if err != nil {
+		log.Printf("ns=static fn=saveMeta at=err err=%q", err)
+	}
+}
+
+// writeFile writes b to a temporary file and renames it to path so
+// readers never see a partial file.
+func writeFile(path string, b []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+var client = &http.Client{
+	Timeout: 5 * time.Minute,
+	Transport: &http.Transport{
+		DialContext: (&net.Dialer{
+			Timeout:   10 * time.Second,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		MaxIdleConns:          100,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: 1 * time.Second,
+	},
+}
+
+// get fetches the zip, returning a nil body if it was not modified.
+func (f *Feed) get() ([]byte, meta, error) {
+	req, err := http.NewRequest("GET", f.URL, nil)
+	if err != nil {
+		log.Printf("ns=static fn=get url=%q at=err err=%q", f.URL, err)
+		return nil, meta{}, err
+	}
+	if f.Current() != nil {
+		if f.meta.ETag != "" {
+			req.Header.Set("If-None-Match", f.meta.ETag)
+		}
+		if f.meta.LastModified != "" {
+			req.Header.Set("If-Modified-Since", f.meta.LastModified)
+		}
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		log.Printf("ns=static fn=get url=%q at=err err=%q", f.URL, err)
+		return nil, meta{}, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotModified {
+		log.Printf("ns=static fn=get url=%q at=not-modified", f.URL)
+		return nil, f.meta, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		err := fmt.Errorf("unexpected status %s", resp.Status)
+		log.Printf("ns=static fn=get url=%q at=err err=%q", f.URL, err)
+		return nil, meta{}, err
+	}
+
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		log.Printf("ns=static fn=get url=%q at=err err=%q", f.URL, err)
+		return nil, meta{}, err
+	}
+
+	sum := sha256.Sum256(b)
+	m := meta{
+		ETag:         resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"),
+		Sum:          sum[:],
+	}
+	log.Printf("ns=static fn=get url=%q at=done bytes=%d", f.URL, len(b))
+	return b, m, nil
+}
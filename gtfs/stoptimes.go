@@ -0,0 +1,273 @@
+package gtfs
+
+import (
+	"sort"
+	"strings"
+	"time"
+)
+
+// StopTimes holds a feed's stop_times.txt rows in a compact columnar
+// form. Trip IDs, stop IDs and headsigns are interned in a string table
+// and referenced by index, so each distinct string is stored once no
+// matter how many rows use it.
+//
+// Static.FillMaps indexes the rows for Static.StopTimesForTrip and
+// Static.StopTimesForStop and orders them by trip and stop sequence.
+type StopTimes struct {
+	strs     []string
+	strIndex map[string]int32
+
+	trip      []int32
+	stop      []int32
+	headsign  []int32
+	arrival   []int32 // seconds
+	departure []int32 // seconds
+	sequence  []int32
+	pickup    []uint8
+	dropOff   []uint8
+	timepoint []uint8
+	shapeDist []float64
+
+	// filled by index
+	byTrip map[int32][2]int32 // trip string -> [start, end) rows
+	byStop map[int32][]int32  // stop string -> rows ordered by departure
+}
+
+// Len returns the number of stop times.
+func (t *StopTimes) Len() int {
+	return len(t.trip)
+}
+
+// At returns the i'th stop time.
+func (t *StopTimes) At(i int) StopTime {
+	return StopTime{
+		TripID:            t.strs[t.trip[i]],
+		ArrivalTime:       time.Duration(t.arrival[i]) * time.Second,
+		DepartureTime:     time.Duration(t.departure[i]) * time.Second,
+		StopID:            t.strs[t.stop[i]],
+		StopSequence:      int(t.sequence[i]),
+		StopHeadsign:      t.strs[t.headsign[i]],
+		PickupType:        PickupDropOffType(t.pickup[i]),
+		DropOffType:       PickupDropOffType(t.dropOff[i]),
+		ShapeDistTraveled: t.shapeDist[i],
+		Timepoint:         Timepoint(t.timepoint[i]),
+	}
+}
+
+// All returns all stop times. It allocates a StopTime per row, so
+// prefer Len and At, or the Static accessors, for large feeds.
+func (t *StopTimes) All() []StopTime {
+	out := make([]StopTime, t.Len())
+	for i := range out {
+		out[i] = t.At(i)
+	}
+	return out
+}
+
+// Append adds st. Indexes built by Static.FillMaps are dropped and must
+// be rebuilt by calling it again.
+func (t *StopTimes) Append(st StopTime) {
+	t.trip = append(t.trip, t.intern(st.TripID))
+	t.stop = append(t.stop, t.intern(st.StopID))
+	t.headsign = append(t.headsign, t.intern(st.StopHeadsign))
+	t.arrival = append(t.arrival, int32(st.ArrivalTime/time.Second))
+	t.departure = append(t.departure, int32(st.DepartureTime/time.Second))
+	t.sequence = append(t.sequence, int32(st.StopSequence))
+	t.pickup = append(t.pickup, uint8(st.PickupType))
+	t.dropOff = append(t.dropOff, uint8(st.DropOffType))
+	t.timepoint = append(t.timepoint, uint8(st.Timepoint))
+	t.shapeDist = append(t.shapeDist, st.ShapeDistTraveled)
+
+	t.byTrip, t.byStop = nil, nil
+}
+
+// AppendAll appends all of o's stop times to t.
+func (t *StopTimes) AppendAll(o *StopTimes) {
+	remap := make([]int32, len(o.strs))
+	for i, s := range o.strs {
+		remap[i] = t.intern(s)
+	}
+	for i := range o.trip {
+		t.trip = append(t.trip, remap[o.trip[i]])
+		t.stop = append(t.stop, remap[o.stop[i]])
+		t.headsign = append(t.headsign, remap[o.headsign[i]])
+	}
+	t.arrival = append(t.arrival, o.arrival...)
+	t.departure = append(t.departure, o.departure...)
+	t.sequence = append(t.sequence, o.sequence...)
+	t.pickup = append(t.pickup, o.pickup...)
+	t.dropOff = append(t.dropOff, o.dropOff...)
+	t.timepoint = append(t.timepoint, o.timepoint...)
+	t.shapeDist = append(t.shapeDist, o.shapeDist...)
+
+	t.byTrip, t.byStop = nil, nil
+}
+
+// TripIDs returns the distinct trip IDs referenced by stop times.
+// FillMaps must have been called.
+func (t *StopTimes) TripIDs() []string {
+	out := make([]string, 0, len(t.byTrip))
+	for id := range t.byTrip {
+		out = append(out, t.strs[id])
+	}
+	sort.Strings(out)
+	return out
+}
+
+func (t *StopTimes) intern(s string) int32 {
+	if i, ok := t.strIndex[s]; ok {
+		return i
+	}
+	if t.strIndex == nil {
+		t.strIndex = make(map[string]int32)
+	}
+	// s is often a substring of a whole CSV record, don't keep that alive
+	s = strings.Clone(s)
+	i := int32(len(t.strs))
+	t.strs = append(t.strs, s)
+	t.strIndex[s] = i
+	return i
+}
+
+// indexed reports whether index has been called since rows were last
+// added.
+func (t *StopTimes) indexed() bool {
+	return t.byTrip != nil
+}
+
+// index orders rows by trip and stop sequence and builds the trip and
+// stop indexes.
+func (t *StopTimes) index() {
+	perm := make([]int32, t.Len())
+	for i := range perm {
+		perm[i] = int32(i)
+	}
+	sort.Slice(perm, func(i, j int) bool {
+		a, b := perm[i], perm[j]
+		if t.trip[a] != t.trip[b] {
+			return t.strs[t.trip[a]] < t.strs[t.trip[b]]
+		}
+		return t.sequence[a] < t.sequence[b]
+	})
+
+	t.trip = permute(t.trip, perm)
+	t.stop = permute(t.stop, perm)
+	t.headsign = permute(t.headsign, perm)
+	t.arrival = permute(t.arrival, perm)
+	t.departure = permute(t.departure, perm)
+	t.sequence = permute(t.sequence, perm)
+	t.pickup = permute(t.pickup, perm)
+	t.dropOff = permute(t.dropOff, perm)
+	t.timepoint = permute(t.timepoint, perm)
+	t.shapeDist = permute(t.shapeDist, perm)
+
+	t.indexTrips()
+
+	t.byStop = make(map[int32][]int32)
+	for i, s := range t.stop {
+		t.byStop[s] = append(t.byStop[s], int32(i))
+	}
+	for _, rows := range t.byStop {
+		sort.Slice(rows, func(i, j int) bool { return t.departure[rows[i]] < t.departure[rows[j]] })
+	}
+}
+
+// indexTrips builds the trip index from rows already ordered by trip.
+func (t *StopTimes) indexTrips() {
+	t.byTrip = make(map[int32][2]int32)
+	for i := 0; i < len(t.trip); {
+		j := i + 1
+		for j < len(t.trip) && t.trip[j] == t.trip[i] {
+			j++
+		}
+		t.byTrip[t.trip[i]] = [2]int32{int32(i), int32(j)}
+		i = j
+	}
+}
+
+// stopRows returns the rows of the stop index, grouped by stop in the
+// order of their string indexes.
+func (t *StopTimes) stopRows() []int32 {
+	stops := make([]int32, 0, len(t.byStop))
+	for s := range t.byStop {
+		stops = append(stops, s)
+	}
+	sort.Slice(stops, func(i, j int) bool { return stops[i] < stops[j] })
+
+	out := make([]int32, 0, len(t.stop))
+	for _, s := range stops {
+		out = append(out, t.byStop[s]...)
+	}
+	return out
+}
+
+// indexFromStopRows restores the indexes of rows already ordered by trip
+// and stop sequence, with the stop index from rows returned by stopRows.
+func (t *StopTimes) indexFromStopRows(rows []int32) {
+	t.indexTrips()
+
+	t.byStop = make(map[int32][]int32)
+	for i := 0; i < len(rows); {
+		s := t.stop[rows[i]]
+		j := i + 1
+		for j < len(rows) && t.stop[rows[j]] == s {
+			j++
+		}
+		t.byStop[s] = rows[i:j:j]
+		i = j
+	}
+}
+
+func (t *StopTimes) forTrip(tripID string) []StopTime {
+	id, ok := t.strIndex[tripID]
+	if !ok {
+		return nil
+	}
+	r, ok := t.byTrip[id]
+	if !ok {
+		return nil
+	}
+	out := make([]StopTime, 0, r[1]-r[0])
+	for i := r[0]; i < r[1]; i++ {
+		out = append(out, t.At(int(i)))
+	}
+	return out
+}
+
+func (t *StopTimes) forStop(stopID string) []StopTime {
+	id, ok := t.strIndex[stopID]
+	if !ok {
+		return nil
+	}
+	rows := t.byStop[id]
+	if len(rows) == 0 {
+		return nil
+	}
+	out := make([]StopTime, 0, len(rows))
+	for _, i := range rows {
+		out = append(out, t.At(int(i)))
+	}
+	return out
+}
+
+// lastSequence returns the stop sequence of the last stop of the trip
+// with the given ID.
+func (t *StopTimes) lastSequence(tripID string) (int, bool) {
+	id, ok := t.strIndex[tripID]
+	if !ok {
+		return 0, false
+	}
+	r, ok := t.byTrip[id]
+	if !ok {
+		return 0, false
+	}
+	return int(t.sequence[r[1]-1]), true
+}
+
+func permute[T any](s []T, perm []int32) []T {
+	out := make([]T, len(s))
+	for i, p := range perm {
+		out[i] = s[p]
+	}
+	return out
+}
@@ -0,0 +1,144 @@
+package timetable
+
+import (
+	"encoding/csv"
+	"fmt"
+	"html/template"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/danp/catchbus/gtfs"
+)
+
+// Cell text for trips that pass a stop or don't serve it.
+const (
+	passesText    = "|"
+	notServedText = ""
+)
+
+// Label returns the trip's short name, or its ID if it has none.
+func (t Trip) Label() string {
+	if t.Trip.ShortName != "" {
+		return t.Trip.ShortName
+	}
+	return t.Trip.ID
+}
+
+// String returns c as printed in a timetable: the time as H:MM, "|" if
+// the trip passes the stop, or nothing if it doesn't serve it.
+func (c Cell) String() string {
+	switch c.Kind {
+	case Stops:
+		return formatClock(c.Time)
+	case Passes:
+		return passesText
+	}
+	return notServedText
+}
+
+// formatClock formats d, a time since noon minus 12h, as H:MM. Seconds
+// are dropped and hours may exceed 23.
+func formatClock(d time.Duration) string {
+	m := int(d / time.Minute)
+	return fmt.Sprintf("%d:%02d", m/60, m%60)
+}
+
+// Title returns a heading for tt naming the route, direction and date.
+func (tt *Timetable) Title() string {
+	name := tt.Route.ShortName
+	if name == "" {
+		name = tt.Route.ID
+	}
+	if tt.Route.LongName != "" {
+		name += " " + tt.Route.LongName
+	}
+	return fmt.Sprintf("Route %s, direction %d, %s", name, tt.DirectionID, gtfs.FormatDate(tt.Date))
+}
+
+// rows returns tt as a header row of trip labels followed by a row per
+// stop, each starting with the stop's name.
+func (tt *Timetable) rows() [][]string {
+	header := []string{"Stop"}
+	for _, t := range tt.Trips {
+		header = append(header, t.Label())
+	}
+	out := [][]string{header}
+	for i, st := range tt.Stops {
+		name := st.Name
+		if name == "" {
+			name = st.ID
+		}
+		row := []string{name}
+		for _, t := range tt.Trips {
+			row = append(row, t.Cells[i].String())
+		}
+		out = append(out, row)
+	}
+	return out
+}
+
+// WriteCSV writes tt to w as CSV, with a header row of trip labels and a
+// row per stop.
+func (tt *Timetable) WriteCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	if err := cw.WriteAll(tt.rows()); err != nil {
+		return err
+	}
+	return cw.Error()
+}
+
+// WriteMarkdown writes tt to w as a Markdown table under a heading.
+func (tt *Timetable) WriteMarkdown(w io.Writer) error {
+	rows := tt.rows()
+	var b strings.Builder
+	fmt.Fprintf(&b, "# %s\n\n", tt.Title())
+	for i, row := range rows {
+		b.WriteString("|")
+		for _, c := range row {
+			b.WriteString(" " + strings.ReplaceAll(c, "|", `\|`) + " |")
+		}
+		b.WriteString("\n")
+		if i == 0 {
+			b.WriteString("|---|")
+			for range row[1:] {
+				b.WriteString("---:|")
+			}
+			b.WriteString("\n")
+		}
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+var htmlTemplate = template.Must(template.New("timetable").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+<style>
+table { border-collapse: collapse; font-family: sans-serif; font-size: 0.9em; }
+th, td { border: 1px solid #ccc; padding: 0.2em 0.5em; }
+td { text-align: right; font-variant-numeric: tabular-nums; }
+tbody th { text-align: left; font-weight: normal; }
+td.passes { text-align: center; color: #888; }
+</style>
+</head>
+<body>
+<h1>{{.Title}}</h1>
+<table>
+<thead>
+<tr><th>Stop</th>{{range .Trips}}<th title="{{.Trip.Headsign}}">{{.Label}}</th>{{end}}</tr>
+</thead>
+<tbody>
+{{range $i, $st := .Stops}}<tr><th>{{if $st.Name}}{{$st.Name}}{{else}}{{$st.ID}}{{end}}</th>{{range $.Trips}}{{with index .Cells $i}}<td class="{{.Kind}}">{{.}}</td>{{end}}{{end}}</tr>
+{{end}}</tbody>
+</table>
+</body>
+</html>
+`))
+
+// WriteHTML writes tt to w as a standalone HTML page.
+func (tt *Timetable) WriteHTML(w io.Writer) error {
+	return htmlTemplate.Execute(w, tt)
+}
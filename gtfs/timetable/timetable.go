@@ -0,0 +1,264 @@
+// Package timetable builds printable timetables of stops by trips from
+// GTFS data.
+package timetable
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/danp/catchbus/gtfs"
+)
+
+// Options configure which stops appear in a Timetable.
+type Options struct {
+	// AllStops includes every stop served, not just timepoints.
+	AllStops bool
+}
+
+// Timetable is a grid of times for the trips of a route in one direction
+// on a service date, with a row per stop and a column per trip.
+type Timetable struct {
+	Route       gtfs.Route
+	DirectionID int
+	Date        time.Time
+
+	// Stops are the rows, in the order trips serve them. When trips
+	// follow different patterns their stops are merged.
+	Stops []gtfs.Stop
+
+	// Trips are the columns, ordered by their time at the stop most
+	// trips stop at, interpolated or by first departure for trips that
+	// don't, then by trip ID.
+	Trips []Trip
+}
+
+// Trip is a column of a Timetable.
+type Trip struct {
+	Trip gtfs.Trip
+
+	// Cells has an entry for each of the timetable's Stops.
+	Cells []Cell
+}
+
+// CellKind describes how a trip relates to a stop.
+type CellKind int
+
+const (
+	// NotServed means the trip starts after or ends before the stop.
+	NotServed CellKind = iota
+
+	// Stops means the trip stops at the stop at Cell.Time.
+	Stops
+
+	// Passes means the trip runs past the stop without stopping, either
+	// because it follows a pattern skipping it or because neither pickup
+	// nor drop off is allowed there.
+	Passes
+)
+
+var cellKindNames = []string{"not_served", "stops", "passes"}
+
+func (k CellKind) String() string {
+	if k < 0 || int(k) >= len(cellKindNames) {
+		return fmt.Sprintf("CellKind(%d)", int(k))
+	}
+	return cellKindNames[k]
+}
+
+// Cell is a trip's time at a stop.
+type Cell struct {
+	Kind CellKind
+
+	// Time is the departure time, or arrival time at the trip's last
+	// stop, as a duration since noon minus 12h on the service date. It is
+	// only set for Stops.
+	Time time.Duration
+}
+
+// New builds the timetable of the trips of the route with the given ID
+// and direction active on service date d. Without opts.AllStops, only
+// stops that are exact timepoints for at least one trip are included.
+// FillMaps must have been called.
+func New(s *gtfs.Static, routeID string, directionID int, d time.Time, opts Options) (*Timetable, error) {
+	r, ok := s.RouteIDsToRoutes[routeID]
+	if !ok {
+		return nil, fmt.Errorf("route %q not found", routeID)
+	}
+
+	var stopIDs []string
+	for _, rd := range s.RouteDirections(routeID) {
+		if rd.DirectionID == directionID {
+			stopIDs = rd.StopIDs
+		}
+	}
+	if stopIDs == nil {
+		return nil, fmt.Errorf("route %q has no trips in direction %d", routeID, directionID)
+	}
+
+	active := s.ActiveServicesForDate(d)
+	var trips []Trip
+	timepoint := make([]bool, len(stopIDs))
+	for _, t := range s.Trips {
+		if t.RouteID != routeID || t.DirectionID != directionID || !active[t.ServiceID] {
+			continue
+		}
+		sts := s.StopTimesForTrip(t.ID)
+		if len(sts) == 0 {
+			continue
+		}
+
+		cells := make([]Cell, len(stopIDs))
+		first, last, pos := -1, -1, -1
+		for i, st := range sts {
+			pos = indexAfter(stopIDs, st.StopID, pos)
+			if pos < 0 {
+				// stopIDs merges every pattern so this shouldn't happen
+				return nil, fmt.Errorf("trip %q stop %q not in route stops", t.ID, st.StopID)
+			}
+			if first < 0 {
+				first = pos
+			}
+			last = pos
+
+			if st.PickupType == gtfs.PickupDropOffNone && st.DropOffType == gtfs.PickupDropOffNone {
+				cells[pos] = Cell{Kind: Passes}
+				continue
+			}
+			tm := st.DepartureTime
+			if i == len(sts)-1 {
+				tm = st.ArrivalTime
+			}
+			cells[pos] = Cell{Kind: Stops, Time: tm}
+			if st.Timepoint == gtfs.TimepointExact {
+				timepoint[pos] = true
+			}
+		}
+		for i := first + 1; i < last; i++ {
+			if cells[i].Kind == NotServed {
+				cells[i].Kind = Passes
+			}
+		}
+
+		trips = append(trips, Trip{Trip: t, Cells: cells})
+	}
+
+	tt := &Timetable{Route: *r, DirectionID: directionID, Date: d}
+	var keep []int
+	for i, id := range stopIDs {
+		if !opts.AllStops && !timepoint[i] {
+			continue
+		}
+		keep = append(keep, i)
+		if st, ok := s.StopIDsToStops[id]; ok {
+			tt.Stops = append(tt.Stops, *st)
+		} else {
+			tt.Stops = append(tt.Stops, gtfs.Stop{ID: id})
+		}
+	}
+	sortTrips(trips)
+	for _, t := range trips {
+		cells := make([]Cell, len(keep))
+		for i, k := range keep {
+			cells[i] = t.Cells[k]
+		}
+		t.Cells = cells
+		tt.Trips = append(tt.Trips, t)
+	}
+
+	return tt, nil
+}
+
+// sortTrips sorts trips by one key each, so the order is consistent
+// however patterns overlap. The key is the time at the reference stop, the
+// stop with the most trips stopping, interpolated by stop index for trips
+// passing it and the first time for trips not reaching it. Trips without
+// any times go last.
+func sortTrips(trips []Trip) {
+	if len(trips) == 0 {
+		return
+	}
+
+	counts := make([]int, len(trips[0].Cells))
+	for _, t := range trips {
+		for i, c := range t.Cells {
+			if c.Kind == Stops {
+				counts[i]++
+			}
+		}
+	}
+	ref := 0
+	for i, n := range counts {
+		if n > counts[ref] {
+			ref = i
+		}
+	}
+
+	type keyed struct {
+		key time.Duration
+		ok  bool
+	}
+	keys := make(map[string]keyed, len(trips))
+	for _, t := range trips {
+		k, ok := t.timeAt(ref)
+		keys[t.Trip.ID] = keyed{k, ok}
+	}
+
+	sort.Slice(trips, func(i, j int) bool {
+		a, b := keys[trips[i].Trip.ID], keys[trips[j].Trip.ID]
+		if a.ok != b.ok {
+			return a.ok
+		}
+		if a.key != b.key {
+			return a.key < b.key
+		}
+		return trips[i].Trip.ID < trips[j].Trip.ID
+	})
+}
+
+// timeAt returns t's time at cell i, interpolated between the nearest
+// stops around it if t doesn't stop there, or t's first time if it has
+// none on one side.
+func (t Trip) timeAt(i int) (time.Duration, bool) {
+	if t.Cells[i].Kind == Stops {
+		return t.Cells[i].Time, true
+	}
+	prev, next := -1, -1
+	for j := i - 1; j >= 0; j-- {
+		if t.Cells[j].Kind == Stops {
+			prev = j
+			break
+		}
+	}
+	for j := i + 1; j < len(t.Cells); j++ {
+		if t.Cells[j].Kind == Stops {
+			next = j
+			break
+		}
+	}
+	if prev < 0 || next < 0 {
+		return t.firstTime()
+	}
+	pt, nt := t.Cells[prev].Time, t.Cells[next].Time
+	return pt + (nt-pt)*time.Duration(i-prev)/time.Duration(next-prev), true
+}
+
+func (t Trip) firstTime() (time.Duration, bool) {
+	for _, c := range t.Cells {
+		if c.Kind == Stops {
+			return c.Time, true
+		}
+	}
+	return 0, false
+}
+
+// indexAfter returns the index of the first id in s after index after,
+// or -1.
+func indexAfter(s []string, id string, after int) int {
+	i := slices.Index(s[after+1:], id)
+	if i < 0 {
+		return -1
+	}
+	return after + 1 + i
+}
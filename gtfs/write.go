@@ -0,0 +1,239 @@
+package gtfs
+
+import (
+	"archive/zip"
+	"encoding/csv"
+	"io"
+	"os"
+	"strconv"
+	"time"
+)
+
+// WriteZipFile writes s as a GTFS zip to path.
+func WriteZipFile(path string, s *Static) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	if err := WriteZip(f, s); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// WriteZip writes s as a GTFS zip to w.
+func WriteZip(w io.Writer, s *Static) error {
+	zw := zip.NewWriter(w)
+
+	for _, f := range []struct {
+		name   string
+		header []string
+		rows   func(func([]string) error) error
+	}{
+		{"agency.txt", agencyHeader, func(wr func([]string) error) error {
+			for _, a := range s.Agencies {
+				if err := wr(agencyRecord(a)); err != nil {
+					return err
+				}
+			}
+			return nil
+		}},
+		{"stops.txt", stopHeader, func(wr func([]string) error) error {
+			for _, st := range s.Stops {
+				if err := wr(stopRecord(st)); err != nil {
+					return err
+				}
+			}
+			return nil
+		}},
+		{"routes.txt", routeHeader, func(wr func([]string) error) error {
+			for _, r := range s.Routes {
+				if err := wr(routeRecord(r)); err != nil {
+					return err
+				}
+			}
+			return nil
+		}},
+		{"trips.txt", tripHeader, func(wr func([]string) error) error {
+			for _, t := range s.Trips {
+				if err := wr(tripRecord(t)); err != nil {
+					return err
+				}
+			}
+			return nil
+		}},
+		{"stop_times.txt", stopTimeHeader, func(wr func([]string) error) error {
+			if s.StopTimes != nil {
+				// see Static.StopTimes
+				for _, st := range s.StopTimes {
+					if err := wr(stopTimeRecord(st)); err != nil {
+						return err
+					}
+				}
+				return nil
+			}
+			for i := 0; i < s.StopTimeTable.Len(); i++ {
+				if err := wr(stopTimeRecord(s.StopTimeTable.At(i))); err != nil {
+					return err
+				}
+			}
+			return nil
+		}},
+		{"calendar.txt", calendarHeader, func(wr func([]string) error) error {
+			for _, c := range s.Calendar {
+				if err := wr(calendarRecord(c)); err != nil {
+					return err
+				}
+			}
+			return nil
+		}},
+		{"calendar_dates.txt", calendarDateHeader, func(wr func([]string) error) error {
+			for _, c := range s.CalendarDates {
+				if err := wr(calendarDateRecord(c)); err != nil {
+					return err
+				}
+			}
+			return nil
+		}},
+		{"shapes.txt", shapeHeader, func(wr func([]string) error) error {
+			for _, sh := range s.Shapes {
+				if err := wr(shapeRecord(sh)); err != nil {
+					return err
+				}
+			}
+			return nil
+		}},
+		{"transfers.txt", transferHeader, func(wr func([]string) error) error {
+			for _, t := range s.Transfers {
+				if err := wr(transferRecord(t)); err != nil {
+					return err
+				}
+			}
+			return nil
+		}},
+	} {
+		if f.name == "transfers.txt" && len(s.Transfers) == 0 {
+			// optional
+			continue
+		}
+
+		fw, err := zw.Create(f.name)
+		if err != nil {
+			return err
+		}
+		cw := csv.NewWriter(fw)
+		if err := cw.Write(f.header); err != nil {
+			return err
+		}
+		if err := f.rows(cw.Write); err != nil {
+			return err
+		}
+		cw.Flush()
+		if err := cw.Error(); err != nil {
+			return err
+		}
+	}
+
+	return zw.Close()
+}
+
+var agencyHeader = []string{"agency_id", "agency_name", "agency_url", "agency_timezone", "agency_lang", "agency_phone", "agency_fare_url", "agency_email"}
+
+func agencyRecord(a Agency) []string {
+	var tz string
+	if a.Timezone != nil {
+		tz = a.Timezone.String()
+	}
+	return []string{a.ID, a.Name, a.URL, tz, a.Lang, a.Phone, a.FareURL, a.Email}
+}
+
+var stopHeader = []string{"stop_id", "stop_code", "stop_name", "stop_desc", "stop_lat", "stop_lon", "zone_id", "stop_url", "location_type", "parent_station", "stop_timezone", "wheelchair_boarding"}
+
+func stopRecord(s Stop) []string {
+	lat, lon := formatPoint(s.Point)
+	return []string{
+		s.ID, s.Code, s.Name, s.Desc, lat, lon, s.ZoneID, s.URL,
+		strconv.Itoa(int(s.LocationType)), s.ParentStation, s.Timezone,
+		strconv.Itoa(int(s.WheelchairBoarding)),
+	}
+}
+
+var routeHeader = []string{"route_id", "agency_id", "route_short_name", "route_long_name", "route_desc", "route_type", "route_url", "route_color", "route_text_color"}
+
+func routeRecord(r Route) []string {
+	return []string{r.ID, r.AgencyID, r.ShortName, r.LongName, r.Desc, strconv.Itoa(int(r.Type)), r.URL, r.Color, r.TextColor}
+}
+
+var tripHeader = []string{"route_id", "service_id", "trip_id", "trip_headsign", "trip_short_name", "direction_id", "block_id", "shape_id", "wheelchair_accessible", "bikes_allowed"}
+
+func tripRecord(t Trip) []string {
+	return []string{
+		t.RouteID, t.ServiceID, t.ID, t.Headsign, t.ShortName,
+		strconv.Itoa(t.DirectionID), t.BlockID, t.ShapeID,
+		strconv.Itoa(int(t.WheelchairAccessible)), strconv.Itoa(int(t.BikesAllowed)),
+	}
+}
+
+var stopTimeHeader = []string{"trip_id", "arrival_time", "departure_time", "stop_id", "stop_sequence", "stop_headsign", "pickup_type", "drop_off_type", "shape_dist_traveled", "timepoint"}
+
+func stopTimeRecord(s StopTime) []string {
+	return []string{
+		s.TripID, FormatTime(s.ArrivalTime), FormatTime(s.DepartureTime), s.StopID,
+		strconv.Itoa(s.StopSequence), s.StopHeadsign,
+		strconv.Itoa(int(s.PickupType)), strconv.Itoa(int(s.DropOffType)),
+		formatDist(s.ShapeDistTraveled), strconv.Itoa(int(s.Timepoint)),
+	}
+}
+
+var calendarHeader = []string{"service_id", "monday", "tuesday", "wednesday", "thursday", "friday", "saturday", "sunday", "start_date", "end_date"}
+
+func calendarRecord(c Calendar) []string {
+	rec := []string{c.ServiceID}
+	for _, d := range []bool{c.Monday, c.Tuesday, c.Wednesday, c.Thursday, c.Friday, c.Saturday, c.Sunday} {
+		if d {
+			rec = append(rec, "1")
+		} else {
+			rec = append(rec, "0")
+		}
+	}
+	return append(rec, FormatDate(c.StartDate), FormatDate(c.EndDate))
+}
+
+var calendarDateHeader = []string{"service_id", "date", "exception_type"}
+
+func calendarDateRecord(c CalendarDate) []string {
+	return []string{c.ServiceID, FormatDate(c.Date), strconv.Itoa(int(c.ExceptionType))}
+}
+
+var shapeHeader = []string{"shape_id", "shape_pt_lat", "shape_pt_lon", "shape_pt_sequence", "shape_dist_traveled"}
+
+func shapeRecord(s Shape) []string {
+	lat, lon := formatPoint(s.Point)
+	return []string{s.ID, lat, lon, strconv.Itoa(s.PtSequence), formatDist(s.DistTraveled)}
+}
+
+var transferHeader = []string{"from_stop_id", "to_stop_id", "from_route_id", "to_route_id", "from_trip_id", "to_trip_id", "transfer_type", "min_transfer_time"}
+
+func transferRecord(t Transfer) []string {
+	var mt string
+	if t.Type == TransferMinTime || t.MinTransferTime > 0 {
+		mt = strconv.Itoa(int(t.MinTransferTime / time.Second))
+	}
+	return []string{t.FromStopID, t.ToStopID, t.FromRouteID, t.ToRouteID, t.FromTripID, t.ToTripID, strconv.Itoa(int(t.Type)), mt}
+}
+
+func formatPoint(p Point) (string, string) {
+	if p == NoPoint {
+		return "", ""
+	}
+	return strconv.FormatFloat(p.Lat, 'f', -1, 64), strconv.FormatFloat(p.Lon, 'f', -1, 64)
+}
+
+func formatDist(d float64) string {
+	if d == NoShapeDistTraveled {
+		return ""
+	}
+	return strconv.FormatFloat(d, 'f', -1, 64)
+}